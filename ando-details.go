@@ -2,7 +2,8 @@ package main
 
 import (
 	"fmt"
-	"log"
+	"strings"
+	"time"
 )
 
 type DataFormat struct {
@@ -77,7 +78,7 @@ func setTransferFormat(ando *AndoConnection, name string) bool {
 		}
 	}
 	if id == 0x0 {
-		log.Printf("Can't find transfer format named %v", name)
+		logf(ando, "Can't find transfer format named %v", name)
 		return false
 	}
 	fmt.Printf("Setting transfer format named %v to '%c'\n", name, id)
@@ -93,3 +94,24 @@ func setTransferFormat(ando *AndoConnection, name string) bool {
 
 	return true
 }
+
+// selectTransferFormat sets transfer format of app and selects it on EPrommer (GENERIC is app only)
+func selectTransferFormat(ando *AndoConnection, format TransferFormat) {
+	ando.transferFormat = format
+	if !ando.dryMode {
+		switch format {
+		case F_ASCIIHex:
+			setTransferFormat(ando, "ASCII Hex")
+		case F_HP64000ABS:
+			setTransferFormat(ando, "HP64000ABS")
+		}
+	}
+	if !currentFirmwareProfile(ando).supportsFormat(format) {
+		logf(ando, "Warning: format %v is not supported for firmware %v\n\r", format, currentFirmwareProfile(ando).name)
+	}
+}
+
+// queryRomType queries currently selected ROM type ('R <SPACE>') and returns the EPrommer's answer
+func queryRomType(ando *AndoConnection) string {
+	return strings.TrimSpace(queryDevice(ando, "R ", 500*time.Millisecond))
+}
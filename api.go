@@ -0,0 +1,577 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The HTTP/JSON API gives test stations and CI jobs access to the EPrommer session, e.g.
+//   GET  /api/status              state of session and device
+//   GET  /api/romtype             ROM type selected on EPrommer
+//   POST /api/romtype?name=2764   select ROM type
+//   POST /api/format?name=hp64k   select transfer format (ascii-hex, hp64k, generic)
+//   POST /api/download            download RAM buffer (job)
+//   GET  /api/buffer?format=hex   data downloaded last as bin, hex (ASCII-Hex) or abs (HP64000ABS)
+//   POST /api/upload?name=fw.bin  upload image in request body (job)
+//   POST /api/blank, /api/program, /api/verify, /api/copy, /api/burn (jobs)
+//   POST /api/keys                send keys in request body to EPrommer, like typed on keyboard
+//   POST /api/write               write data downloaded last to file (like ': w')
+//   GET  /api/romtypes            known ROM types
+//   GET  /api/jobs, /api/jobs/{id} job history
+//   GET  /api/events              server-sent events: job state and progress
+// Only one job runs at a time, a job started while another one is running is refused (409). Requests using
+// the session are refused as well while a job or a keyboard command runs, /api/status then returns the
+// status taken before. Requests sent by web pages of other origins are refused (403), so that a page opened
+// in the browser can't use the EPrommer.
+
+// APIJob a long running operation started by API
+type APIJob struct {
+	ID       int        `json:"id"`
+	Name     string     `json:"name"`
+	State    string     `json:"state"` // running, passed, failed
+	Reply    string     `json:"reply,omitempty"`
+	Started  time.Time  `json:"started"`
+	Finished *time.Time `json:"finished,omitempty"`
+}
+
+// APIStatus state of session as returned by /api/status
+type APIStatus struct {
+	Device     string            `json:"device"`
+	State      string            `json:"state"`
+	RomType    string            `json:"romType"`
+	Format     string            `json:"format"`
+	Firmware   string            `json:"firmware"`
+	LastPassed bool              `json:"lastPassed"`
+	LastReply  string            `json:"lastReply"`
+	Downloaded int               `json:"downloaded"`
+	Identified string            `json:"identified,omitempty"`
+	Edits      int               `json:"edits"`
+	Checksums  map[string]string `json:"checksums,omitempty"`
+	Job        *APIJob           `json:"job,omitempty"`
+}
+
+// APIServer HTTP API on a session
+type APIServer struct {
+	ando        *AndoConnection
+	mutex       sync.Mutex
+	jobs        []*APIJob
+	running     *APIJob
+	status      APIStatus            // status taken last while session was not used
+	subscribers map[chan string]bool // server-sent events clients
+}
+
+// apiDeviceCommands device commands available as jobs
+var apiDeviceCommands = map[string]string{
+	"blank":   "PC\r",
+	"program": "PD\r",
+	"verify":  "PE\r",
+	"copy":    "PA\r",
+}
+
+// newAPIServer creates API server for session. Must be called before ttyReader is started, as it
+// installs the console hook read by ttyReader.
+func newAPIServer(ando *AndoConnection) *APIServer {
+	api := &APIServer{ando: ando, subscribers: make(map[chan string]bool)}
+	hook := ando.consoleHook
+	ando.consoleHook = func(chunk []byte) {
+		if hook != nil {
+			hook(chunk)
+		}
+		api.publish("console", string(chunk))
+	}
+	return api
+}
+
+// handler returns HTTP handler of all API endpoints
+func (api *APIServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/status", api.handleStatus)
+	mux.HandleFunc("GET /api/romtype", api.handleRomType)
+	mux.HandleFunc("POST /api/romtype", api.handleSelectRomType)
+	mux.HandleFunc("POST /api/format", api.handleFormat)
+	mux.HandleFunc("GET /api/buffer", api.handleBuffer)
+	mux.HandleFunc("POST /api/download", func(w http.ResponseWriter, r *http.Request) {
+		api.startJob(w, "download", downloadImage)
+	})
+	mux.HandleFunc("POST /api/upload", api.handleUpload)
+	mux.HandleFunc("POST /api/burn", func(w http.ResponseWriter, r *http.Request) {
+		api.startJob(w, "burn", burn)
+	})
+	for name, keys := range apiDeviceCommands {
+		mux.HandleFunc("POST /api/"+name, func(w http.ResponseWriter, r *http.Request) {
+			api.startJob(w, name, func(ando *AndoConnection) bool {
+				return deviceCommand(ando, keys)
+			})
+		})
+	}
+	mux.HandleFunc("POST /api/keys", api.handleKeys)
+	mux.HandleFunc("POST /api/write", api.handleWrite)
+	mux.HandleFunc("GET /api/romtypes", api.handleRomTypes)
+	mux.HandleFunc("GET /api/jobs", api.handleJobs)
+	mux.HandleFunc("GET /api/jobs/{id}", api.handleJob)
+	mux.HandleFunc("GET /api/events", api.handleEvents)
+	mux.Handle("GET /", webHandler())
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !sameOrigin(r) {
+			writeError(w, http.StatusForbidden, "request from other origin "+r.Header.Get("Origin"))
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// sameOrigin returns true if request has no Origin header (e.g. curl) or was sent by a page of this server
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	originURL, err := url.Parse(origin)
+	return err == nil && originURL.Host == r.Host
+}
+
+// runAPIServer serves API on address until it fails
+func runAPIServer(api *APIServer, address string) error {
+	log.Printf("HTTP API on http://%v/api/status, web UI on http://%v/\n\r", address, address)
+	return http.ListenAndServe(address, api.handler())
+}
+
+// daemon runs API only, without interactive UI: daemon [address]
+func daemon(ando *AndoConnection, args []string) int {
+	address := "127.0.0.1:8080"
+	if len(args) > 1 {
+		address = args[1]
+	}
+	api := newAPIServer(ando)
+	go ttyReader(ando)
+	err := runAPIServer(api, address)
+	log.Printf("Error serving HTTP API: %s\n\r", err)
+	return ExitError
+}
+
+// writeJSON writes value as JSON response
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+// writeError writes error message as JSON response
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+// handleStatus returns status of session. While a job or a keyboard command uses the session, the status
+// taken last is returned with state "busy".
+func (api *APIServer) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if api.ando.sessionLock.TryLock() {
+		status := api.snapshot()
+		api.ando.sessionLock.Unlock()
+		api.mutex.Lock()
+		api.status = status
+		api.mutex.Unlock()
+	} else {
+		api.mutex.Lock()
+		api.status.State = "busy"
+		api.mutex.Unlock()
+	}
+	api.mutex.Lock()
+	status := api.status
+	status.Job = api.running
+	api.mutex.Unlock()
+	writeJSON(w, http.StatusOK, status)
+}
+
+// snapshot returns status of session, caller holds session lock
+func (api *APIServer) snapshot() APIStatus {
+	ando := api.ando
+	status := APIStatus{
+		Device:     ando.serial.device,
+		State:      ando.state.String(),
+		RomType:    romTypeName(ando),
+		Format:     ando.transferFormat.String(),
+		Firmware:   firmwareName(ando),
+		LastPassed: ando.lastPassed,
+		LastReply:  ando.lastReply,
+		Downloaded: len(ando.lineInfos) * 16,
+		Identified: ando.identified,
+		Edits:      len(ando.edits),
+	}
+	if len(ando.lineInfos) > 0 {
+		status.Checksums = checksumMap(ando.checksums)
+	}
+	return status
+}
+
+func (api *APIServer) handleRomType(w http.ResponseWriter, r *http.Request) {
+	if !api.acquire(w) {
+		return
+	}
+	defer api.ando.sessionLock.Unlock()
+	reply := updateRomType(api.ando)
+	writeJSON(w, http.StatusOK, map[string]string{"romType": romTypeName(api.ando), "reply": reply})
+}
+
+func (api *APIServer) handleSelectRomType(w http.ResponseWriter, r *http.Request) {
+	if !api.acquire(w) {
+		return
+	}
+	defer api.ando.sessionLock.Unlock()
+	name := r.URL.Query().Get("name")
+	romType := findRomType(name)
+	if romType == nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("unknown ROM type '%v'", name))
+		return
+	}
+	if !selectRomType(api.ando, name) {
+		writeError(w, http.StatusBadGateway, fmt.Sprintf("selecting ROM type %v failed", name))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"romType": romTypeName(api.ando)})
+}
+
+func (api *APIServer) handleFormat(w http.ResponseWriter, r *http.Request) {
+	if !api.acquire(w) {
+		return
+	}
+	defer api.ando.sessionLock.Unlock()
+	format, ok := parseTransferFormat(r.URL.Query().Get("name"))
+	if !ok {
+		writeError(w, http.StatusBadRequest, "unknown transfer format, use ascii-hex, hp64k or generic")
+		return
+	}
+	selectTransferFormat(api.ando, format)
+	writeJSON(w, http.StatusOK, map[string]string{"format": api.ando.transferFormat.String()})
+}
+
+// handleBuffer returns data downloaded last in format bin (default), hex (ASCII-Hex) or abs (HP64000ABS)
+func (api *APIServer) handleBuffer(w http.ResponseWriter, r *http.Request) {
+	if !api.acquire(w) {
+		return
+	}
+	defer api.ando.sessionLock.Unlock()
+	if len(api.ando.lineInfos) == 0 {
+		writeError(w, http.StatusNotFound, "no data downloaded yet")
+		return
+	}
+	image := downloadedImage(api.ando)
+	profile := currentFirmwareProfile(api.ando)
+	format := r.URL.Query().Get("format")
+	var data []byte
+	switch format {
+	case "", "bin":
+		format = "bin"
+		data = image
+	case "hex":
+		data = encodeASCIIHex(image, 0, profile)
+	case "abs":
+		data = encodeHp64K(image, 0, profile)
+	default:
+		writeError(w, http.StatusBadRequest, "unknown format, use bin, hex or abs")
+		return
+	}
+	filename := createFileName(filepath.Base(api.ando.downloadFile), api.ando.identified, api.ando.checksum)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", strings.TrimSuffix(filename, ".bin")+"."+format))
+	w.Write(data)
+}
+
+// handleUpload stores image in request body in a temporary file and uploads it (job).
+// Query parameter name gives the file name, its extension selects the file format (e.g. .abs).
+func (api *APIServer) handleUpload(w http.ResponseWriter, r *http.Request) {
+	name := filepath.Base(r.URL.Query().Get("name"))
+	if name == "." || name == "/" {
+		name = "upload.bin"
+	}
+	dir, err := os.MkdirTemp("", "ando-upload")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	filename := filepath.Join(dir, name)
+	limit := maxUploadSize(name)
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, int64(limit)))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		os.RemoveAll(dir)
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("%v is larger than %v bytes", name, limit))
+		return
+	}
+	if err == nil {
+		err = os.WriteFile(filename, data, 0644)
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	started := api.startJob(w, "upload "+name, func(ando *AndoConnection) bool {
+		defer os.RemoveAll(dir)
+		uploadFile := ando.uploadFile
+		ando.uploadFile = filename
+		defer func() { ando.uploadFile = uploadFile }()
+		return uploadAndWait(ando)
+	})
+	if !started {
+		os.RemoveAll(dir)
+	}
+}
+
+// maxUploadSize returns size of largest upload accepted for file name: capacity of largest ROM type.
+// Text images (ASCII-Hex, hex dump) take up to 6 characters per byte, HP64000ABS records add a header.
+func maxUploadSize(name string) int {
+	size := maxRomTypeSize()
+	ext := strings.ToLower(filepath.Ext(name))
+	if slices.Contains(textImageExtensions, ext) {
+		return 6 * size
+	}
+	if ext == ".abs" {
+		return 2 * size
+	}
+	return size
+}
+
+// handleKeys sends keys in request body to EPrommer
+func (api *APIServer) handleKeys(w http.ResponseWriter, r *http.Request) {
+	if !api.acquire(w) {
+		return
+	}
+	defer api.ando.sessionLock.Unlock()
+	keys, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !sendKeys(api.ando, string(keys)) {
+		writeError(w, http.StatusBadGateway, "sending keys failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"sent": len(keys)})
+}
+
+// handleWrite writes data downloaded last to file
+func (api *APIServer) handleWrite(w http.ResponseWriter, r *http.Request) {
+	if !api.acquire(w) {
+		return
+	}
+	defer api.ando.sessionLock.Unlock()
+	if len(api.ando.lineInfos) == 0 {
+		writeError(w, http.StatusNotFound, "no data downloaded yet")
+		return
+	}
+	writeDataToFile(api.ando)
+	writeJSON(w, http.StatusOK, map[string]string{"file": createFileName(api.ando.downloadFile, api.ando.identified, api.ando.checksum)})
+}
+
+func (api *APIServer) handleRomTypes(w http.ResponseWriter, r *http.Request) {
+	var names []string
+	for _, romType := range romTypes {
+		names = append(names, romType.name)
+	}
+	writeJSON(w, http.StatusOK, names)
+}
+
+func (api *APIServer) handleJobs(w http.ResponseWriter, r *http.Request) {
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+	writeJSON(w, http.StatusOK, api.jobs)
+}
+
+func (api *APIServer) handleJob(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+	if err != nil || id < 1 || id > len(api.jobs) {
+		writeError(w, http.StatusNotFound, "unknown job")
+		return
+	}
+	writeJSON(w, http.StatusOK, api.jobs[id-1])
+}
+
+// busy writes 409 response and returns true if a job is running
+func (api *APIServer) busy(w http.ResponseWriter) bool {
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+	if api.running != nil {
+		writeError(w, http.StatusConflict, fmt.Sprintf("job %v (%v) is running", api.running.ID, api.running.Name))
+		return true
+	}
+	return false
+}
+
+// acquire takes the session for a request. Writes 409 response and returns false if a job or a keyboard
+// command uses the session. The caller releases the session with api.ando.sessionLock.Unlock().
+func (api *APIServer) acquire(w http.ResponseWriter) bool {
+	if api.busy(w) {
+		return false
+	}
+	if !api.ando.sessionLock.TryLock() {
+		writeError(w, http.StatusConflict, "session is used by a keyboard command")
+		return false
+	}
+	return true
+}
+
+// lockSession takes the session for a keyboard command, so that it does not run while an HTTP API job
+// uses the session. Returns false if the session is used.
+func lockSession(ando *AndoConnection) bool {
+	if ando.sessionLock == nil || ando.sessionLock.TryLock() {
+		if ando.transferHold != nil {
+			ando.transferHold <- struct{}{}
+		}
+		return true
+	}
+	logf(ando, "\n\rSession is used by an HTTP API job, try again when it is done\n\r")
+	return false
+}
+
+// unlockSession releases session taken by lockSession. Transfers started by keyboard (': d', ': u', ': v')
+// return while ttyReader still waits for the EPrommer, the session is then released by ttyReader when the
+// transfer ends.
+func unlockSession(ando *AndoConnection) {
+	if ando.sessionLock == nil {
+		return
+	}
+	if ando.transferHold == nil {
+		ando.sessionLock.Unlock()
+		return
+	}
+	if ando.state == ReceiveData || ando.state == SendData || ando.state == VerifyData {
+		return
+	}
+	select {
+	case <-ando.transferHold:
+		ando.sessionLock.Unlock()
+	default:
+		// transfer ended already and ttyReader released the session
+	}
+}
+
+// releaseTransferHold releases session held by a keyboard command until its transfer ended, called by
+// ttyReader when session is back in NormalInput
+func releaseTransferHold(ando *AndoConnection) {
+	select {
+	case <-ando.transferHold:
+		ando.sessionLock.Unlock()
+	default:
+	}
+}
+
+// startJob starts job running run in background and writes 202 response with job. Returns false if
+// another job or a keyboard command uses the session. The session is held until the job is done.
+func (api *APIServer) startJob(w http.ResponseWriter, name string, run func(ando *AndoConnection) bool) bool {
+	if !api.acquire(w) {
+		return false
+	}
+	api.mutex.Lock()
+	job := &APIJob{ID: len(api.jobs) + 1, Name: name, State: "running", Started: time.Now()}
+	api.jobs = append(api.jobs, job)
+	api.running = job
+	api.mutex.Unlock()
+	log.Printf("API job %v: %v\n\r", job.ID, name)
+	api.publish("job", job)
+
+	done := make(chan bool)
+	go api.reportProgress(job, done)
+	go func() {
+		passed := run(api.ando)
+		api.ando.sessionLock.Unlock()
+		finished := time.Now()
+		api.mutex.Lock()
+		job.State = "failed"
+		if passed {
+			job.State = "passed"
+		}
+		job.Reply = api.ando.lastReply
+		job.Finished = &finished
+		api.running = nil
+		api.mutex.Unlock()
+		close(done)
+		log.Printf("API job %v: %v %v\n\r", job.ID, name, job.State)
+		api.publish("job", job)
+	}()
+	writeJSON(w, http.StatusAccepted, job)
+	return true
+}
+
+// reportProgress publishes progress of running job every 500ms until done is closed
+func (api *APIServer) reportProgress(job *APIJob, done chan bool) {
+	for {
+		select {
+		case <-done:
+			return
+		case <-time.After(500 * time.Millisecond):
+		}
+		event := map[string]interface{}{
+			"job":     job.ID,
+			"state":   api.ando.state.String(),
+			"seconds": time.Since(job.Started).Seconds(),
+		}
+		if progress := activeProgress(api.ando); progress != nil {
+			event["operation"] = progress.operation
+			event["done"] = progress.done
+			event["total"] = progress.total
+			event["rate"] = progress.rate()
+			if eta := progress.eta(); eta >= 0 {
+				event["eta"] = eta.Seconds()
+			}
+		}
+		api.publish("progress", event)
+	}
+}
+
+// publish sends event to all server-sent events clients. Clients not keeping up miss events.
+func (api *APIServer) publish(event string, value interface{}) {
+	data, _ := json.Marshal(value)
+	message := fmt.Sprintf("event: %v\ndata: %s\n\n", event, data)
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+	for subscriber := range api.subscribers {
+		select {
+		case subscriber <- message:
+		default:
+		}
+	}
+}
+
+// handleEvents streams events to client until it disconnects
+func (api *APIServer) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	events := make(chan string, 256)
+	api.mutex.Lock()
+	api.subscribers[events] = true
+	api.mutex.Unlock()
+	defer func() {
+		api.mutex.Lock()
+		delete(api.subscribers, events)
+		api.mutex.Unlock()
+	}()
+	flusher.Flush()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case message := <-events:
+			io.WriteString(w, message)
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMaxUploadSize(t *testing.T) {
+	largest := maxRomTypeSize()
+	tests := []struct {
+		name string
+		size int
+	}{
+		{"fw.bin", largest},
+		{"fw", largest},
+		{"fw.abs", 2 * largest},
+		{"fw.HEX", 6 * largest},
+		{"fw.dump", 6 * largest},
+	}
+	for _, test := range tests {
+		if size := maxUploadSize(test.name); size != test.size {
+			t.Errorf("maxUploadSize(%v) = %v, want %v", test.name, size, test.size)
+		}
+	}
+}
+
+// request sends request to test server, returns status code and decoded JSON body
+func request(t *testing.T, server *httptest.Server, method string, path string, body string) (int, map[string]interface{}) {
+	req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var value map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&value)
+	return resp.StatusCode, value
+}
+
+func TestAPIBusySession(t *testing.T) {
+	ando, _ := newFakeSession(nil)
+	ando.sessionLock = &sync.Mutex{}
+	ando.lineInfos = []LineInfo{{lineNumber: 1, address: 0xf}}
+	server := httptest.NewServer(newAPIServer(ando).handler())
+	defer server.Close()
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		free   int // status code if session is free, 0 if not requested (starts a job)
+		busy   int // status code while session is used by a keyboard command
+	}{
+		{"GET", "/api/buffer?format=bin", "", http.StatusOK, http.StatusConflict},
+		{"GET", "/api/buffer?format=srec", "", http.StatusBadRequest, http.StatusConflict},
+		{"POST", "/api/format?name=hp64k", "", http.StatusOK, http.StatusConflict},
+		{"POST", "/api/romtype?name=2764", "", http.StatusBadGateway, http.StatusConflict}, // fake EPrommer does not answer
+		{"POST", "/api/keys", "R ", http.StatusOK, http.StatusConflict},
+		{"POST", "/api/upload?name=fw.bin", strings.Repeat("x", maxRomTypeSize()+1), http.StatusRequestEntityTooLarge,
+			http.StatusRequestEntityTooLarge},
+		{"POST", "/api/download", "", 0, http.StatusConflict},
+		{"POST", "/api/burn", "", 0, http.StatusConflict},
+		{"GET", "/api/status", "", http.StatusOK, http.StatusOK},
+	}
+	for _, test := range tests {
+		if test.free == 0 {
+			continue
+		}
+		code, _ := request(t, server, test.method, test.path, test.body)
+		if code != test.free {
+			t.Errorf("%v %v with free session = %v, want %v", test.method, test.path, code, test.free)
+		}
+	}
+	ando.sessionLock.Lock()
+	for _, test := range tests {
+		code, _ := request(t, server, test.method, test.path, test.body)
+		if code != test.busy {
+			t.Errorf("%v %v with busy session = %v, want %v", test.method, test.path, code, test.busy)
+		}
+	}
+	_, status := request(t, server, "GET", "/api/status", "")
+	if status["state"] != "busy" || status["format"] != "HP64000ABS" {
+		t.Errorf("status of busy session = %v, want state busy and format taken before", status)
+	}
+	ando.sessionLock.Unlock()
+	if _, status := request(t, server, "GET", "/api/status", ""); status["state"] != "idle" {
+		t.Errorf("status of free session = %v, want state idle", status)
+	}
+}
+
+func TestAPISelectRomType(t *testing.T) {
+	ando, _ := newFakeSession(func(keys string) string {
+		if keys == "R " {
+			return "R 2C\r\n"
+		}
+		return ""
+	})
+	ando.sessionLock = &sync.Mutex{}
+	server := httptest.NewServer(newAPIServer(ando).handler())
+	defer server.Close()
+	tests := []struct {
+		name    string
+		code    int
+		romType string
+	}{
+		{"27C256", http.StatusOK, "27C256"},
+		{"2764", http.StatusBadGateway, ""},
+		{"9999", http.StatusBadRequest, ""},
+	}
+	for _, test := range tests {
+		code, body := request(t, server, "POST", "/api/romtype?name="+test.name, "")
+		if code != test.code || (test.romType != "" && body["romType"] != test.romType) {
+			t.Errorf("POST /api/romtype?name=%v = %v %v, want %v %v", test.name, code, body, test.code, test.romType)
+		}
+	}
+}
+
+func TestAPIJobHoldsSession(t *testing.T) {
+	ando, _ := newFakeSession(nil)
+	ando.sessionLock = &sync.Mutex{}
+	api := newAPIServer(ando)
+	release := make(chan bool)
+	started := api.startJob(httptest.NewRecorder(), "test", func(ando *AndoConnection) bool {
+		<-release
+		return true
+	})
+	if !started {
+		t.Fatal("startJob() = false with free session")
+	}
+	if lockSession(ando) {
+		t.Error("lockSession() = true while job runs")
+	}
+	recorder := httptest.NewRecorder()
+	if api.startJob(recorder, "second", func(ando *AndoConnection) bool { return true }) ||
+		recorder.Code != http.StatusConflict {
+		t.Errorf("second job started while job runs, response %v", recorder.Code)
+	}
+	release <- true
+	for !api.ando.sessionLock.TryLock() {
+		time.Sleep(time.Millisecond)
+	}
+	api.ando.sessionLock.Unlock()
+	if !lockSession(ando) {
+		t.Error("lockSession() = false after job finished")
+	}
+	recorder = httptest.NewRecorder()
+	if api.startJob(recorder, "keyboard", func(ando *AndoConnection) bool { return true }) ||
+		recorder.Code != http.StatusConflict {
+		t.Errorf("job started while keyboard command runs, response %v", recorder.Code)
+	}
+	unlockSession(ando)
+}
+
+func TestAPIOrigin(t *testing.T) {
+	ando, tty := newFakeSession(nil)
+	ando.sessionLock = &sync.Mutex{}
+	server := httptest.NewServer(newAPIServer(ando).handler())
+	defer server.Close()
+	tests := []struct {
+		origin string
+		code   int
+	}{
+		{"", http.StatusOK},
+		{server.URL, http.StatusOK},
+		{"http://evil.example", http.StatusForbidden},
+		{"null", http.StatusForbidden},
+	}
+	for _, test := range tests {
+		tty.written.Reset()
+		req, err := http.NewRequest("POST", server.URL+"/api/keys", strings.NewReader("R "))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.origin != "" {
+			req.Header.Set("Origin", test.origin)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != test.code {
+			t.Errorf("Origin %q: POST /api/keys = %v, want %v", test.origin, resp.StatusCode, test.code)
+		}
+		if sent := tty.written.String() != ""; sent != (test.code == http.StatusOK) {
+			t.Errorf("Origin %q: keys sent %q", test.origin, tty.written.String())
+		}
+	}
+}
+
+// TestKeyboardTransferHoldsSession starts a download with ': d', which returns while ttyReader still
+// receives data. The session must be held until the download ended.
+func TestKeyboardTransferHoldsSession(t *testing.T) {
+	ando, _ := newFakeSession(nil)
+	ando.sessionLock = &sync.Mutex{}
+	ando.transferHold = make(chan struct{}, 1)
+	ando.romType = findRomType("2764")
+	if !lockSession(ando) {
+		t.Fatal("lockSession() = false with free session")
+	}
+	compoundCommand(ando, nil, 'd')
+	unlockSession(ando)
+	if ando.sessionLock.TryLock() {
+		t.Fatal("session released while download runs")
+	}
+	handleDeviceFailure(ando, "FAIL")
+	if !ando.sessionLock.TryLock() {
+		t.Fatal("session not released after download ended")
+	}
+	ando.sessionLock.Unlock()
+
+	// command without transfer releases session at once
+	if !lockSession(ando) {
+		t.Fatal("lockSession() = false with free session")
+	}
+	compoundCommand(ando, nil, 'l')
+	unlockSession(ando)
+	if !ando.sessionLock.TryLock() {
+		t.Fatal("session not released after command")
+	}
+	ando.sessionLock.Unlock()
+}
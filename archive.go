@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DumpMetadata information stored in a JSON sidecar file next to every saved dump
+// and in the archive index
+type DumpMetadata struct {
+	Date       string            `json:"date"`
+	File       string            `json:"file"`
+	RawFile    string            `json:"rawFile,omitempty"`
+	Model      string            `json:"model"`
+	Firmware   string            `json:"firmware"`
+	RomType    string            `json:"romType"`
+	Format     string            `json:"format"`
+	Size       int               `json:"size"`             // number of data bytes, without padding in front
+	Start      int               `json:"start,omitempty"`  // RAM buffer address of first data byte
+	Offset     int               `json:"offset,omitempty"` // file address of first data byte, padded with 0xff before
+	Identified string            `json:"identified,omitempty"`
+	Checksums  map[string]string `json:"checksums"`
+	Note       string            `json:"note,omitempty"`
+}
+
+// archiveIndexName name of archive index file, located in directory of dumps
+const archiveIndexName = "dumps-index.jsonl"
+
+// checksumMap converts checksums into a map, used for JSON output
+func checksumMap(sums Checksums) map[string]string {
+	return map[string]string{
+		"range":  fmt.Sprintf("0x%08x:0x%x", sums.start, sums.length),
+		"sum16":  fmt.Sprintf("%04x", sums.sum16),
+		"sum32":  fmt.Sprintf("%08x", sums.sum32),
+		"crc16":  fmt.Sprintf("%04x", sums.crc16),
+		"crc32":  fmt.Sprintf("%08x", sums.crc32),
+		"md5":    sums.md5,
+		"sha1":   sums.sha1,
+		"sha256": sums.sha256,
+	}
+}
+
+// archiveDump writes raw capture, JSON sidecar and archive index entry for dump saved as filename.
+// size is the number of data bytes, which are placed at file address --offset.
+func archiveDump(ando *AndoConnection, filename string, size int) {
+	metadata := DumpMetadata{
+		Date:       time.Now().Format(time.RFC3339),
+		File:       filename,
+		Model:      ando.model,
+		Firmware:   firmwareName(ando),
+		RomType:    romTypeName(ando),
+		Format:     ando.transferFormat.String(),
+		Size:       size,
+		Start:      ando.rangeStart,
+		Offset:     ando.offset,
+		Identified: ando.identified,
+		Checksums:  checksumMap(ando.checksums),
+		Note:       ando.note,
+	}
+
+	// Raw capture as received from EPrommer, useful to debug transfer formats
+	if len(ando.generic.rawData) > 0 {
+		metadata.RawFile = strings.TrimSuffix(filename, filepath.Ext(filename)) + ".raw"
+		err := os.WriteFile(metadata.RawFile, ando.generic.rawData, 0644)
+		if err != nil {
+			logf(ando, "Error Writing raw capture file %s\n\r", err)
+			metadata.RawFile = ""
+		}
+	}
+
+	data, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		logf(ando, "Error creating metadata %s\n\r", err)
+		return
+	}
+	sidecar := strings.TrimSuffix(filename, filepath.Ext(filename)) + ".json"
+	err = os.WriteFile(sidecar, append(data, '\n'), 0644)
+	if err != nil {
+		logf(ando, "Error Writing metadata file %s\n\r", err)
+		return
+	}
+	logf(ando, "Wrote metadata to %v\n\r", sidecar)
+
+	// Append to archive index, one JSON object per line
+	data, _ = json.Marshal(metadata)
+	index := filepath.Join(filepath.Dir(filename), archiveIndexName)
+	file, err := os.OpenFile(index, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		logf(ando, "Error opening archive index %s\n\r", err)
+		return
+	}
+	defer file.Close()
+	_, err = file.Write(append(data, '\n'))
+	if err != nil {
+		logf(ando, "Error writing archive index %s\n\r", err)
+	}
+}
+
+// searchArchive returns all entries of archive index in dir matching term. Term is matched
+// case-insensitive against all checksums (prefix), ROM type, identified name, note and file name.
+func searchArchive(dir string, term string) ([]DumpMetadata, error) {
+	var matches []DumpMetadata
+	file, err := os.Open(filepath.Join(dir, archiveIndexName))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	term = strings.ToLower(term)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var metadata DumpMetadata
+		if json.Unmarshal(scanner.Bytes(), &metadata) != nil {
+			continue
+		}
+		if metadataMatches(metadata, term) {
+			matches = append(matches, metadata)
+		}
+	}
+	return matches, scanner.Err()
+}
+
+// metadataMatches returns true if lower case term matches metadata
+func metadataMatches(metadata DumpMetadata, term string) bool {
+	for _, sum := range metadata.Checksums {
+		if strings.HasPrefix(sum, term) {
+			return true
+		}
+	}
+	for _, text := range []string{metadata.RomType, metadata.Identified, metadata.Note, metadata.File} {
+		if strings.Contains(strings.ToLower(text), term) {
+			return true
+		}
+	}
+	return false
+}
+
+// printArchiveEntry pretty print an entry of archive index
+func printArchiveEntry(metadata DumpMetadata) {
+	fmt.Printf("%v %v\n\r", metadata.Date, metadata.File)
+	fmt.Printf("  %v %v, ROM type %v, %v, %v bytes, crc32 %v\n\r", metadata.Model, metadata.Firmware,
+		metadata.RomType, metadata.Format, metadata.Size, metadata.Checksums["crc32"])
+	if metadata.Start != 0 || metadata.Offset != 0 {
+		fmt.Printf("  buffer address 0x%x, file address 0x%x\n\r", metadata.Start, metadata.Offset)
+	}
+	if metadata.Identified != "" {
+		fmt.Printf("  identified: %v\n\r", metadata.Identified)
+	}
+	if metadata.Note != "" {
+		fmt.Printf("  note: %v\n\r", metadata.Note)
+	}
+}
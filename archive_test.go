@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMetadataMatches(t *testing.T) {
+	metadata := DumpMetadata{
+		File:       "dumps/eprom-3a5c01.bin",
+		RomType:    "27C256",
+		Identified: "Promac 2A V21.9 IC10",
+		Note:       "from bench supply",
+		Checksums:  map[string]string{"crc32": "a04a63aa", "sha1": "eab8bbbc"},
+	}
+	tests := []struct {
+		term  string
+		match bool
+	}{
+		{"a04a", true},
+		{"eab8bbbc", true},
+		{"63aa", false},
+		{"27c256", true},
+		{"promac", true},
+		{"bench", true},
+		{"3a5c01", true},
+		{"2764", false},
+	}
+	for _, test := range tests {
+		if metadataMatches(metadata, test.term) != test.match {
+			t.Errorf("metadataMatches(%q) is %v", test.term, !test.match)
+		}
+	}
+}
+
+func TestSearchArchive(t *testing.T) {
+	dir := t.TempDir()
+	var index []byte
+	for _, metadata := range []DumpMetadata{
+		{File: "a.bin", RomType: "2764", Checksums: map[string]string{"crc32": "11111111"}},
+		{File: "b.bin", RomType: "27C256", Checksums: map[string]string{"crc32": "22222222"}},
+		{File: "c.bin", RomType: "2764", Note: "second dump", Checksums: map[string]string{"crc32": "33333333"}},
+	} {
+		data, _ := json.Marshal(metadata)
+		index = append(index, data...)
+		index = append(index, '\n')
+	}
+	index = append(index, "not json\n"...)
+	if err := os.WriteFile(filepath.Join(dir, archiveIndexName), index, 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		term  string
+		files []string
+	}{
+		{"2764", []string{"a.bin", "c.bin"}},
+		{"2222", []string{"b.bin"}},
+		{"SECOND", []string{"c.bin"}},
+		{"2716", nil},
+	}
+	for _, test := range tests {
+		matches, err := searchArchive(dir, test.term)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var files []string
+		for _, match := range matches {
+			files = append(files, match.File)
+		}
+		if len(files) != len(test.files) {
+			t.Errorf("searchArchive(%q) found %v, want %v", test.term, files, test.files)
+			continue
+		}
+		for i := range files {
+			if files[i] != test.files[i] {
+				t.Errorf("searchArchive(%q) found %v, want %v", test.term, files, test.files)
+			}
+		}
+	}
+	if _, err := searchArchive(t.TempDir(), "x"); err == nil {
+		t.Errorf("missing archive index gave no error")
+	}
+}
+
+func TestWriteDataToFileMetadata(t *testing.T) {
+	tests := []struct {
+		name   string
+		start  int
+		length int
+		offset int
+		trim   bool
+		size   int
+		file   int
+	}{
+		{"complete", 0, -1, 0, false, 32, 32},
+		{"range at offset", 0x10, 8, 0x100, false, 8, 0x108},
+		{"trimmed at offset", 0, -1, 0x20, true, 20, 0x34},
+	}
+	for _, test := range tests {
+		dir := t.TempDir()
+		var line1, line2 LineInfo
+		for i := range line1.codes {
+			line1.codes[i] = byte(i + 1)
+			line2.codes[i] = 0xff
+		}
+		line2.codes[3] = 0x55
+		ando := &AndoConnection{
+			downloadFile: filepath.Join(dir, "out"),
+			lineInfos:    []LineInfo{line1, line2},
+			generic:      &GenericData{},
+			rangeStart:   test.start,
+			rangeLength:  test.length,
+			offset:       test.offset,
+			trim:         test.trim,
+			fill:         0xff,
+			lanes:        1,
+		}
+		writeDataToFile(ando)
+		matches, err := searchArchive(dir, "out")
+		if err != nil || len(matches) != 1 {
+			t.Fatalf("%v: archive has %v, %v", test.name, matches, err)
+		}
+		metadata := matches[0]
+		if metadata.Size != test.size || metadata.Start != test.start || metadata.Offset != test.offset {
+			t.Errorf("%v: size %v start %v offset %v, want %v %v %v", test.name, metadata.Size, metadata.Start,
+				metadata.Offset, test.size, test.start, test.offset)
+		}
+		data, err := os.ReadFile(metadata.File)
+		if err != nil || len(data) != test.file {
+			t.Errorf("%v: file has %v bytes, want %v (%v)", test.name, len(data), test.file, err)
+		}
+	}
+}
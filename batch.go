@@ -0,0 +1,329 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// Exit codes of batch mode
+const (
+	ExitOK      = 0
+	ExitFailed  = 1 // job was executed but failed (e.g. verify mismatch)
+	ExitError   = 2 // job could not be executed (e.g. device or file error)
+	ExitUnknown = 3 // unknown job name
+)
+
+// runBatch executes a non-interactive job and returns exit code for the process.
+// args[0] is the job name, further elements are job arguments.
+func runBatch(ando *AndoConnection, args []string) int {
+	job := args[0]
+	logf(ando, "Running batch job '%v'\n\r", job)
+	if ando.selectRomType != "" && !selectRomType(ando, ando.selectRomType) {
+		return ExitError
+	}
+	switch job {
+	case "upload":
+		uploadFile(ando)
+		if !waitForState(ando, NormalInput, ando.serial.timeout) {
+			logf(ando, "Upload did not complete\n\r")
+			return ExitError
+		}
+		if !ando.lastPassed {
+			return ExitFailed
+		}
+		return ExitOK
+	case "verify-device":
+		verifyFileOnDevice(ando)
+		if !waitForState(ando, NormalInput, ando.serial.timeout) {
+			logf(ando, "Device verify did not complete\n\r")
+			return ExitError
+		}
+		if !ando.lastPassed {
+			return ExitFailed
+		}
+		return ExitOK
+	case "identify":
+		image, err := loadImage(ando.uploadFile)
+		if err != nil {
+			logf(ando, "Error loading input file %s: %s\n\r", ando.uploadFile, err)
+			return ExitError
+		}
+		if identifyDownload(ando, image) == "" {
+			return ExitFailed
+		}
+		return ExitOK
+	case "romtypes":
+		for _, romType := range romTypes {
+			fmt.Printf("%v\n\r", romType)
+		}
+		return ExitOK
+	case "catalog":
+		for _, entry := range ando.catalog {
+			fmt.Printf("%v\n\r", entry)
+		}
+		return ExitOK
+	case "search":
+		if len(args) < 2 {
+			logf(ando, "Usage: search <checksum|rom type|note>\n\r")
+			return ExitError
+		}
+		matches, err := searchArchive(filepath.Dir(ando.downloadFile), args[1])
+		if err != nil {
+			logf(ando, "Error searching archive index %s\n\r", err)
+			return ExitError
+		}
+		for _, metadata := range matches {
+			printArchiveEntry(metadata)
+		}
+		logf(ando, "%v dumps found\n\r", len(matches))
+		if len(matches) == 0 {
+			return ExitFailed
+		}
+		return ExitOK
+	case "split":
+		// split <file> [lanes]
+		if len(args) < 2 {
+			logf(ando, "Usage: split <file> [lanes]\n\r")
+			return ExitError
+		}
+		lanes := max(ando.lanes, 2)
+		if len(args) > 2 {
+			var err error
+			lanes, err = strconv.Atoi(args[2])
+			if err != nil || lanes < 2 {
+				logf(ando, "Usage: split <file> [lanes], lanes must be a number of at least 2, not '%v'\n\r", args[2])
+				return ExitError
+			}
+		}
+		if !splitFile(ando, args[1], lanes) {
+			return ExitError
+		}
+		return ExitOK
+	case "merge":
+		// merge <outfile> <lane 0 file> <lane 1 file> ...
+		if len(args) < 4 {
+			logf(ando, "Usage: merge <file> <lane 0 file> <lane 1 file> ...\n\r")
+			return ExitError
+		}
+		if !mergeFiles(ando, args[1], args[2:]) {
+			return ExitError
+		}
+		return ExitOK
+	case "convert":
+		// convert <infile> <outfile>: apply lane, range and image operations, write binary file
+		if len(args) < 3 {
+			logf(ando, "Usage: convert <infile> <outfile>\n\r")
+			return ExitError
+		}
+		image, err := loadImage(args[1])
+		if err != nil {
+			logf(ando, "Error loading file %s: %s\n\r", args[1], err)
+			return ExitError
+		}
+		image = placeBytes(nil, uint32(ando.offset), prepareUploadImage(ando, image))
+		err = os.WriteFile(args[2], image, 0644)
+		if err != nil {
+			logf(ando, "Error Writing file %s\n\r", err)
+			return ExitError
+		}
+		printChecksums(computeChecksums(image, ando.sumStart, ando.sumLength))
+		return ExitOK
+	case "diff":
+		// diff <file a> [<file b>]: without file b, file a is compared with RAM buffer
+		if len(args) < 2 {
+			logf(ando, "Usage: diff <file a> [<file b>]\n\r")
+			return ExitError
+		}
+		identical := false
+		if len(args) > 2 {
+			identical = diffFiles(ando, args[1], args[2])
+		} else {
+			if !downloadImage(ando) {
+				return ExitError
+			}
+			identical = diffDownload(ando, args[1])
+		}
+		if !identical {
+			return ExitFailed
+		}
+		return ExitOK
+	case "burn":
+		if !burn(ando) {
+			return ExitFailed
+		}
+		return ExitOK
+	case "program-check":
+		check, ok := programCheck(ando)
+		if !ok {
+			return ExitError
+		}
+		if check.eraseRequired() {
+			return ExitFailed
+		}
+		return ExitOK
+	case "download":
+		if !downloadImage(ando) {
+			return ExitError
+		}
+		writeDataToFile(ando)
+		return ExitOK
+	case "verify":
+		if ando.copyFirst && !deviceCommand(ando, "PA\r") {
+			logf(ando, "DEVICE-COPY failed\n\r")
+			return ExitError
+		}
+		if !downloadImage(ando) {
+			return ExitError
+		}
+		if !verifyDownload(ando) {
+			return ExitFailed
+		}
+		return ExitOK
+	case "script":
+		if len(args) < 2 {
+			logf(ando, "Usage: script <file>\n\r")
+			return ExitError
+		}
+		return runScriptFile(ando, args[1], nil)
+	}
+	logf(ando, "Unknown batch job '%v'\n\r", job)
+	return ExitUnknown
+}
+
+// sendKeys sends a key sequence to EPrommer, like typed on keyboard
+func sendKeys(ando *AndoConnection, keys string) bool {
+	if ando.dryMode {
+		logf(ando, "Dry mode, not sending '%v'\n\r", keys)
+		return true
+	}
+	_, err := ando.serial.tty.Write([]byte(keys))
+	publishStatus(ando)
+	if err != nil {
+		logf(ando, "Error in Write: %s\n", err)
+		return false
+	}
+	return true
+}
+
+// waitForState waits until ttyReader has moved connection into state. Returns false on timeout and in
+// dry mode, where EPrommer never answers.
+func waitForState(ando *AndoConnection, state ConnState, timeout time.Duration) bool {
+	if ando.dryMode && ando.state != state {
+		logf(ando, "Dry mode, no answer from EPrommer\n\r")
+		return false
+	}
+	deadline := time.Now().Add(timeout)
+	for ando.state != state {
+		publishStatus(ando)
+		if time.Now().After(deadline) || !running(ando) {
+			return false
+		}
+		time.Sleep(25 * time.Millisecond)
+	}
+	publishStatus(ando)
+	return true
+}
+
+// captureConsole keeps recent human-readable output of EPrommer, used to query information. Called by
+// ttyReader, the output is read by other goroutines with consoleText.
+func captureConsole(ando *AndoConnection, chunk []byte) {
+	lockConsole(ando)
+	ando.console = append(ando.console, chunk...)
+	if len(ando.console) > 4096 {
+		ando.console = ando.console[len(ando.console)-4096:]
+	}
+	unlockConsole(ando)
+	if ando.consoleHook != nil {
+		ando.consoleHook(chunk)
+	}
+}
+
+// resetConsole forgets output of EPrommer captured so far
+func resetConsole(ando *AndoConnection) {
+	lockConsole(ando)
+	ando.console = nil
+	unlockConsole(ando)
+}
+
+// consoleText returns output of EPrommer captured since last reset
+func consoleText(ando *AndoConnection) string {
+	lockConsole(ando)
+	defer unlockConsole(ando)
+	return string(ando.console)
+}
+
+func lockConsole(ando *AndoConnection) {
+	if ando.consoleLock != nil {
+		ando.consoleLock.Lock()
+	}
+}
+
+func unlockConsole(ando *AndoConnection) {
+	if ando.consoleLock != nil {
+		ando.consoleLock.Unlock()
+	}
+}
+
+// queryDevice sends keys and returns human-readable output of EPrommer received within wait
+func queryDevice(ando *AndoConnection, keys string, wait time.Duration) string {
+	resetConsole(ando)
+	if ando.dryMode || !sendKeys(ando, keys) {
+		return ""
+	}
+	time.Sleep(wait)
+	return consoleText(ando)
+}
+
+// startDownload starts download of EPrommer's RAM buffer (U7), data is collected by ttyReader
+func startDownload(ando *AndoConnection) {
+	knownRomType(ando)
+	ando.startTime = time.Now()
+	ando.progress = newProgress("download", expectedDownloadSize(ando))
+	ando.lineInfos = nil
+	ando.edits = nil
+	ando.checksum = 0
+	ando.transferErrors = 0
+	initGenericFormat(ando)
+	ando.endCriteriaTest = 0
+
+	ando.state = ReceiveData
+	sendKeys(ando, "U7\r")
+}
+
+// downloadImage downloads EPrommer's RAM buffer and waits for completion.
+// Returns true if data was received and parsed without errors.
+func downloadImage(ando *AndoConnection) bool {
+	startDownload(ando)
+	if !waitForState(ando, NormalInput, ando.serial.timeout) {
+		logf(ando, "Download did not complete within %v\n\r", ando.serial.timeout)
+		ando.state = NormalInput
+		return false
+	}
+	if ando.transferErrors > 0 || len(ando.lineInfos) == 0 {
+		logf(ando, "Download failed\n\r")
+		return false
+	}
+	return true
+}
+
+// deviceCommand sends a device command (e.g. "PA\r" for DEVICE-COPY) and waits for '[PASS]'
+func deviceCommand(ando *AndoConnection, keys string) bool {
+	ando.endCriteriaTest = 0
+	ando.failCriteriaCollecting = false
+	ando.lastPassed = false
+	ando.lastReply = ""
+	ando.state = DeviceCommand
+	if !sendKeys(ando, keys) {
+		ando.state = NormalInput
+		return false
+	}
+	if !waitForState(ando, NormalInput, ando.serial.timeout) {
+		logf(ando, "No '[PASS]' received for command '%v' within %v\n\r", keys, ando.serial.timeout)
+		ando.state = NormalInput
+		return false
+	}
+	return ando.lastPassed
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// BurnStep a step of the burn workflow
+type BurnStep struct {
+	name        string
+	description string
+	run         func(ando *AndoConnection) bool // returns true if step passed
+}
+
+var burnSteps = []BurnStep{
+	BurnStep{name: "blank", description: "DEVICE-BLANK (P C)", run: func(ando *AndoConnection) bool {
+		return deviceCommand(ando, "PC\r")
+	}},
+	BurnStep{name: "upload", description: "Upload (U6)", run: uploadAndWait},
+	BurnStep{name: "program", description: "DEVICE-PROGRAM (P D)", run: func(ando *AndoConnection) bool {
+		return deviceCommand(ando, "PD\r")
+	}},
+	BurnStep{name: "verify", description: "DEVICE-VERIFY (P E)", run: func(ando *AndoConnection) bool {
+		return deviceCommand(ando, "PE\r")
+	}},
+}
+
+// BurnStepResult result of a step of the burn workflow, as stored in burn log
+type BurnStepResult struct {
+	Name    string  `json:"name"`
+	Passed  bool    `json:"passed"`
+	Reply   string  `json:"reply,omitempty"`
+	Seconds float64 `json:"seconds"`
+}
+
+// BurnRecord entry of burn log, records what was burned and the result
+type BurnRecord struct {
+	Date      string            `json:"date"`
+	File      string            `json:"file"`
+	Model     string            `json:"model"`
+	Firmware  string            `json:"firmware"`
+	RomType   string            `json:"romType"`
+	Checksums map[string]string `json:"checksums,omitempty"`
+	Note      string            `json:"note,omitempty"`
+	Steps     []BurnStepResult  `json:"steps"`
+	Result    string            `json:"result"`
+}
+
+// burnLogName name of burn log file, located in directory of dumps
+const burnLogName = "burn-log.jsonl"
+
+// uploadAndWait uploads file to EPrommer's RAM buffer and waits for '[PASS]'
+func uploadAndWait(ando *AndoConnection) bool {
+	ando.lastPassed = false
+	uploadFile(ando)
+	if !waitForState(ando, NormalInput, ando.serial.timeout) {
+		logf(ando, "Upload did not complete within %v\n\r", ando.serial.timeout)
+		ando.state = NormalInput
+		return false
+	}
+	return ando.lastPassed
+}
+
+// burn runs blank check, upload, program and verify of file --infile. Stops at first failing step.
+// Returns true if all steps passed. Result is appended to burn log.
+func burn(ando *AndoConnection) bool {
+	record := BurnRecord{
+		Date:     time.Now().Format(time.RFC3339),
+		File:     ando.uploadFile,
+		Model:    ando.model,
+		Firmware: firmwareName(ando),
+		Note:     ando.note,
+		Result:   "PASS",
+	}
+	if len(ando.edits) > 0 {
+		record.File = "edited RAM buffer"
+	}
+	logf(ando, "Burning %v\n\r", record.File)
+	for i, step := range burnSteps {
+		printBurnProgress(i, step.description, "running")
+		start := time.Now()
+		passed := step.run(ando)
+		result := BurnStepResult{
+			Name:    step.name,
+			Passed:  passed,
+			Reply:   ando.lastReply,
+			Seconds: time.Since(start).Seconds(),
+		}
+		record.Steps = append(record.Steps, result)
+		if step.name == "upload" {
+			record.Checksums = checksumMap(ando.uploadSums)
+		}
+		if !passed {
+			printBurnProgress(i, step.description, fmt.Sprintf("FAILED after %.1fs", result.Seconds))
+			record.Result = "FAIL: " + step.name
+			logf(ando, "Burn stopped: %v failed%v\n\r", step.description, burnFailureHint(step.name, ando.lastReply))
+			break
+		}
+		printBurnProgress(i+1, step.description, fmt.Sprintf("PASS in %.1fs", result.Seconds))
+	}
+	record.RomType = romTypeName(ando)
+	writeBurnLog(ando, record)
+	if record.Result == "PASS" {
+		logf(ando, "Burn PASSED, chip holds %v\n\r", record.File)
+		return true
+	}
+	return false
+}
+
+// burnFailureHint returns a hint for a failed step, including EPrommer's reply
+func burnFailureHint(name string, reply string) string {
+	hint := ""
+	if reply != "" {
+		hint = fmt.Sprintf(", EPrommer replied [%v]", reply)
+	}
+	switch name {
+	case "blank":
+		hint += ". Chip is not blank: erase it, or check with program-check whether a patch-burn is possible"
+	case "upload":
+		hint += ". Chip was not touched"
+	case "program":
+		hint += ". Chip may be partially programmed"
+	case "verify":
+		hint += ". Chip contents differ from RAM buffer"
+	}
+	return hint
+}
+
+// printBurnProgress prints a progress bar over all steps and status of current step
+func printBurnProgress(done int, description string, status string) {
+	bar := strings.Repeat("#", done) + strings.Repeat("-", len(burnSteps)-done)
+	fmt.Printf("\n\r[%v] %v: %v\n\r", bar, description, status)
+}
+
+// writeBurnLog appends record to burn log in directory of dumps, one JSON object per line
+func writeBurnLog(ando *AndoConnection, record BurnRecord) {
+	data, _ := json.Marshal(record)
+	filename := filepath.Join(filepath.Dir(ando.downloadFile), burnLogName)
+	file, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		logf(ando, "Error opening burn log %s\n\r", err)
+		return
+	}
+	defer file.Close()
+	_, err = file.Write(append(data, '\n'))
+	if err != nil {
+		logf(ando, "Error writing burn log %s\n\r", err)
+		return
+	}
+	logf(ando, "Burn logged to %v\n\r", filename)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBurnFailureHint(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply string
+		hint  string
+	}{
+		{"blank", "FAIL", ", EPrommer replied [FAIL]. Chip is not blank: erase it, or check with program-check whether a patch-burn is possible"},
+		{"upload", "", ". Chip was not touched"},
+		{"program", "FAIL 0100", ", EPrommer replied [FAIL 0100]. Chip may be partially programmed"},
+		{"verify", "", ". Chip contents differ from RAM buffer"},
+		{"other", "ERR", ", EPrommer replied [ERR]"},
+	}
+	for _, test := range tests {
+		if hint := burnFailureHint(test.name, test.reply); hint != test.hint {
+			t.Errorf("burnFailureHint(%v, %v) = %q, want %q", test.name, test.reply, hint, test.hint)
+		}
+	}
+}
+
+func TestWriteBurnLog(t *testing.T) {
+	dir := t.TempDir()
+	ando := &AndoConnection{downloadFile: filepath.Join(dir, "out")}
+	for _, result := range []string{"PASS", "FAIL: blank"} {
+		writeBurnLog(ando, BurnRecord{File: "fw.bin", Result: result, Steps: []BurnStepResult{{Name: "blank"}}})
+	}
+	data, err := os.ReadFile(filepath.Join(dir, burnLogName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("burn log has %v lines, want 2", len(lines))
+	}
+	var record BurnRecord
+	if err := json.Unmarshal([]byte(lines[1]), &record); err != nil || record.Result != "FAIL: blank" || record.File != "fw.bin" {
+		t.Errorf("second record %v, %v", record, err)
+	}
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"hash/crc32"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// CatalogEntry a known ROM image
+type CatalogEntry struct {
+	name   string // name of ROM image, e.g. "PROMAC2A-V21.9-IC10"
+	source string // file the entry was read from
+	size   int
+	crc32  uint32
+	sha1   string
+	data   []byte // image content, only available for entries read from image files
+}
+
+// defaultCatalog catalog used if --catalog is not given and the file exists
+const defaultCatalog = "roms/catalog.csv"
+
+// loadCatalog reads all known ROM images from a directory or a single catalog file. Supported are DAT
+// files (*.dat, XML '<rom name=.. size=.. crc=.. sha1=../>' entries), CSV files (*.csv, 'name,size,crc32,sha1')
+// and image files in any format loadImage supports (*.bin, *.hex, *.abs, *.rom).
+func loadCatalog(path string) []CatalogEntry {
+	info, err := os.Stat(path)
+	if err != nil {
+		log.Printf("Error reading ROM catalog %s: %s\n\r", path, err)
+		return nil
+	}
+	filenames := []string{path}
+	if info.IsDir() {
+		files, err := os.ReadDir(path)
+		if err != nil {
+			log.Printf("Error reading ROM catalog directory %s: %s\n\r", path, err)
+			return nil
+		}
+		filenames = nil
+		for _, file := range files {
+			if !file.IsDir() {
+				filenames = append(filenames, filepath.Join(path, file.Name()))
+			}
+		}
+	}
+	var catalog []CatalogEntry
+	known := make(map[string]int)
+	for _, filename := range filenames {
+		for _, entry := range readCatalogFile(filename) {
+			key := fmt.Sprintf("%v-%08x-%v", entry.size, entry.crc32, entry.sha1)
+			i, found := known[key]
+			if !found {
+				known[key] = len(catalog)
+				catalog = append(catalog, entry)
+				continue
+			}
+			// same image may be available in several formats, or listed in a DAT/CSV file with
+			// a more descriptive name. Names from DAT/CSV files win, image content is kept.
+			if entry.data == nil {
+				catalog[i].name = entry.name
+				catalog[i].source = entry.source
+			} else if catalog[i].data == nil {
+				catalog[i].data = entry.data
+			}
+		}
+	}
+	log.Printf("Loaded %v known ROM images from catalog %s\n\r", len(catalog), path)
+	return catalog
+}
+
+// loadDefaultCatalog loads defaultCatalog if it exists, nil if it does not
+func loadDefaultCatalog() []CatalogEntry {
+	if _, err := os.Stat(defaultCatalog); err != nil {
+		return nil
+	}
+	return loadCatalog(defaultCatalog)
+}
+
+// readCatalogFile reads entries of a catalog file, file type is taken from extension.
+// Files of other types give no entries.
+func readCatalogFile(filename string) []CatalogEntry {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".dat":
+		return readCatalogDat(filename)
+	case ".csv":
+		return readCatalogCsv(filename)
+	case ".bin", ".hex", ".abs", ".rom":
+		return readCatalogImage(filename)
+	}
+	return nil
+}
+
+// readCatalogImage creates a catalog entry from an image file, name is file name without extensions
+func readCatalogImage(filename string) []CatalogEntry {
+	data, err := loadImage(filename)
+	if err != nil {
+		log.Printf("Error loading catalog image %s: %s\n\r", filename, err)
+		return nil
+	}
+	name := filepath.Base(filename)
+	for filepath.Ext(name) != "" {
+		name = strings.TrimSuffix(name, filepath.Ext(name))
+	}
+	sums := computeChecksums(data, 0, -1)
+	return []CatalogEntry{{name, filename, len(data), sums.crc32, sums.sha1, data}}
+}
+
+var datRomPattern = regexp.MustCompile(`<rom\s[^>]*>`)
+var datAttributePattern = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// readCatalogDat reads '<rom .../>' entries of a XML DAT file
+func readCatalogDat(filename string) []CatalogEntry {
+	var entries []CatalogEntry
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		log.Printf("Error reading catalog file %s: %s\n\r", filename, err)
+		return nil
+	}
+	for _, rom := range datRomPattern.FindAllString(string(data), -1) {
+		entry := CatalogEntry{source: filename}
+		for _, attribute := range datAttributePattern.FindAllStringSubmatch(rom, -1) {
+			switch attribute[1] {
+			case "name":
+				entry.name = attribute[2]
+			case "size":
+				entry.size, _ = strconv.Atoi(attribute[2])
+			case "crc":
+				value, _ := strconv.ParseUint(attribute[2], 16, 32)
+				entry.crc32 = uint32(value)
+			case "sha1":
+				entry.sha1 = strings.ToLower(attribute[2])
+			}
+		}
+		if entry.name != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// readCatalogCsv reads a CSV file with columns name, size, crc32, sha1. Lines not matching are ignored.
+func readCatalogCsv(filename string) []CatalogEntry {
+	var entries []CatalogEntry
+	file, err := os.Open(filename)
+	if err != nil {
+		log.Printf("Error reading catalog file %s: %s\n\r", filename, err)
+		return nil
+	}
+	defer file.Close()
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+	records, err := reader.ReadAll()
+	if err != nil {
+		log.Printf("Error reading catalog file %s: %s\n\r", filename, err)
+		return nil
+	}
+	for _, record := range records {
+		if len(record) < 4 {
+			continue
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(record[1]))
+		if err != nil {
+			// header line
+			continue
+		}
+		crc, err := strconv.ParseUint(strings.TrimSpace(record[2]), 16, 32)
+		if err != nil {
+			continue
+		}
+		entries = append(entries, CatalogEntry{
+			name:   strings.TrimSpace(record[0]),
+			source: filename,
+			size:   size,
+			crc32:  uint32(crc),
+			sha1:   strings.ToLower(strings.TrimSpace(record[3])),
+		})
+	}
+	return entries
+}
+
+// identifyImage looks up image in catalog. Returns matching entry, or if there is none the closest
+// entry with image content available and its number of differing bytes (-1 if there is none).
+func identifyImage(catalog []CatalogEntry, image []byte) (*CatalogEntry, bool, int) {
+	crc := crc32.ChecksumIEEE(image)
+	sha1 := computeChecksums(image, 0, -1).sha1
+	for i, entry := range catalog {
+		if entry.size != len(image) || entry.crc32 != crc {
+			continue
+		}
+		if entry.sha1 == "" || entry.sha1 == sha1 {
+			return &catalog[i], true, 0
+		}
+	}
+	var closest *CatalogEntry
+	closestDiffs := -1
+	for i, entry := range catalog {
+		if entry.data == nil {
+			continue
+		}
+		diffs := countDiffs(entry.data, image)
+		if closestDiffs == -1 || diffs < closestDiffs {
+			closest = &catalog[i]
+			closestDiffs = diffs
+		}
+	}
+	return closest, false, closestDiffs
+}
+
+// countDiffs counts differing bytes of two images, bytes missing in one image count as different
+func countDiffs(a []byte, b []byte) int {
+	diffs := 0
+	for i := 0; i < len(a) || i < len(b); i++ {
+		if i >= len(a) || i >= len(b) || a[i] != b[i] {
+			diffs++
+		}
+	}
+	return diffs
+}
+
+// identifyDownload identifies data downloaded last and prints the result.
+// Returns the name of the matching ROM image or "" if it is unknown.
+func identifyDownload(ando *AndoConnection, image []byte) string {
+	if ando.catalog == nil {
+		return ""
+	}
+	entry, match, diffs := identifyImage(ando.catalog, image)
+	if match {
+		logf(ando, "This is %v (%v)\n\r", entry.name, entry.source)
+		return entry.name
+	}
+	if entry != nil {
+		logf(ando, "No match, closest is %v with %v bytes different\n\r", entry.name, diffs)
+	} else {
+		logf(ando, "No match in ROM catalog\n\r")
+	}
+	return ""
+}
+
+// catalogFileName converts name of a catalog entry into a string usable in a file name
+func catalogFileName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == ' ' || r == '\\' || r == ':' {
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+// String returns a short description of catalog entry
+func (entry CatalogEntry) String() string {
+	return fmt.Sprintf("%v %v bytes crc32 %08x sha1 %v", entry.name, entry.size, entry.crc32, entry.sha1)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadCatalog(t *testing.T) {
+	dir := t.TempDir()
+	image := []byte("123456789")
+	files := map[string]string{
+		"known.csv":  "# comment\nname,size,crc32,sha1\nDigits,9,cbf43926,F7C3BC1D808E04732ADF679965CCC34CA7AE3441\nbroken,x,0,\n",
+		"known.dat":  `<datafile><rom name="other.bin" size="4" crc="01020304" sha1="aa"/></datafile>`,
+		"digits.bin": string(image),
+		"notes.md":   "not a catalog file",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	catalog := loadCatalog(dir)
+	if len(catalog) != 2 {
+		t.Fatalf("%v entries, want 2: %v", len(catalog), catalog)
+	}
+	entry, match, _ := identifyImage(catalog, image)
+	if !match || entry.name != "Digits" || entry.data == nil {
+		t.Errorf("identified %v, match %v", entry, match)
+	}
+
+	catalog = loadCatalog(filepath.Join(dir, "known.csv"))
+	if len(catalog) != 1 || catalog[0].name != "Digits" || catalog[0].sha1 != "f7c3bc1d808e04732adf679965ccc34ca7ae3441" {
+		t.Errorf("catalog file gave %v", catalog)
+	}
+	if catalog := loadCatalog(filepath.Join(dir, "missing")); catalog != nil {
+		t.Errorf("missing catalog gave %v", catalog)
+	}
+}
+
+func TestIdentifyImage(t *testing.T) {
+	catalog := []CatalogEntry{
+		{name: "A", size: 4, crc32: 0x12345678},
+		{name: "B", size: 4, data: []byte{1, 2, 3, 4}},
+		{name: "C", size: 4, data: []byte{1, 0, 0, 0}},
+	}
+	catalog[0].crc32 = computeChecksums([]byte{9, 9, 9, 9}, 0, -1).crc32
+	tests := []struct {
+		image []byte
+		name  string
+		match bool
+		diffs int
+	}{
+		{[]byte{9, 9, 9, 9}, "A", true, 0},
+		{[]byte{1, 2, 3, 0}, "B", false, 1},
+		{[]byte{1, 0, 0}, "C", false, 1},
+	}
+	for _, test := range tests {
+		entry, match, diffs := identifyImage(catalog, test.image)
+		if entry == nil || entry.name != test.name || match != test.match || diffs != test.diffs {
+			t.Errorf("identifyImage(% x) = %v, %v, %v", test.image, entry, match, diffs)
+		}
+	}
+	if entry, match, diffs := identifyImage(catalog[:1], []byte{1}); entry != nil || match || diffs != -1 {
+		t.Errorf("no image content: %v, %v, %v", entry, match, diffs)
+	}
+}
+
+func TestCatalogFileName(t *testing.T) {
+	if name := catalogFileName("Promac 2A V21.9/IC10:a\\b"); name != "Promac_2A_V21.9_IC10_a_b" {
+		t.Errorf("catalogFileName gave %v", name)
+	}
+}
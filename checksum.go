@@ -0,0 +1,111 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"strconv"
+	"strings"
+)
+
+// Checksums all checksums and hashes calculated over a range of an image
+type Checksums struct {
+	start  int    // first byte of range
+	length int    // number of bytes in range
+	sum16  uint16 // 16-bit byte sum, like shown by Ando AF-9704 after DEVICE-COPY
+	sum32  uint32 // 32-bit byte sum
+	crc16  uint16 // CRC-16/CCITT (polynomial 0x1021, initial value 0xffff)
+	crc32  uint32 // CRC-32 (IEEE), like used by emulator ROM sets
+	md5    string
+	sha1   string // SHA-1, like used by emulator ROM sets
+	sha256 string
+}
+
+// computeChecksums calculates all checksums over data range [start, start+length).
+// length -1 means up to end of data. Range is clipped to data size.
+func computeChecksums(data []byte, start int, length int) Checksums {
+	if start > len(data) {
+		start = len(data)
+	}
+	data = sliceRange(data, start, length)
+
+	sums := Checksums{
+		start:  start,
+		length: len(data),
+		crc16:  crc16CCITT(data),
+		crc32:  crc32.ChecksumIEEE(data),
+	}
+	for _, b := range data {
+		sums.sum32 += uint32(b)
+	}
+	sums.sum16 = uint16(sums.sum32)
+	md5Sum := md5.Sum(data)
+	sums.md5 = hex.EncodeToString(md5Sum[:])
+	sha1Sum := sha1.Sum(data)
+	sums.sha1 = hex.EncodeToString(sha1Sum[:])
+	sha256Sum := sha256.Sum256(data)
+	sums.sha256 = hex.EncodeToString(sha256Sum[:])
+	return sums
+}
+
+// crc16CCITT calculates CRC-16/CCITT (polynomial 0x1021, initial value 0xffff, no reflection)
+func crc16CCITT(data []byte) uint16 {
+	var crc uint16 = 0xffff
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// String returns all checksums as text, one per line
+func (sums Checksums) String() string {
+	sb := new(strings.Builder)
+	fmt.Fprintf(sb, "range:  0x%08x-0x%08x (%v bytes)\n", sums.start, sums.start+sums.length, sums.length)
+	fmt.Fprintf(sb, "sum16:  %04x\n", sums.sum16)
+	fmt.Fprintf(sb, "sum32:  %08x\n", sums.sum32)
+	fmt.Fprintf(sb, "crc16:  %04x\n", sums.crc16)
+	fmt.Fprintf(sb, "crc32:  %08x\n", sums.crc32)
+	fmt.Fprintf(sb, "md5:    %v\n", sums.md5)
+	fmt.Fprintf(sb, "sha1:   %v\n", sums.sha1)
+	fmt.Fprintf(sb, "sha256: %v\n", sums.sha256)
+	return sb.String()
+}
+
+// printChecksums pretty print checksums
+func printChecksums(sums Checksums) {
+	fmt.Printf("%v\r", strings.ReplaceAll(sums.String(), "\n", "\n\r"))
+}
+
+// parseRange parses a range given as 'start:length' (values decimal or 0x-prefixed hex).
+// Empty string means complete image (start 0, length -1).
+func parseRange(text string) (int, int, error) {
+	if text == "" {
+		return 0, -1, nil
+	}
+	parts := strings.Split(text, ":")
+	if len(parts) != 2 {
+		return 0, -1, fmt.Errorf("range '%v' is not of form start:length", text)
+	}
+	start, err := strconv.ParseUint(parts[0], 0, 32)
+	if err != nil {
+		return 0, -1, fmt.Errorf("illegal range start '%v'", parts[0])
+	}
+	if parts[1] == "" {
+		return int(start), -1, nil
+	}
+	length, err := strconv.ParseUint(parts[1], 0, 32)
+	if err != nil {
+		return 0, -1, fmt.Errorf("illegal range length '%v'", parts[1])
+	}
+	return int(start), int(length), nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import "testing"
+
+func TestCRC16CCITT(t *testing.T) {
+	tests := []struct {
+		data []byte
+		crc  uint16
+	}{
+		{nil, 0xffff},
+		{[]byte("123456789"), 0x29b1},
+		{[]byte{0x0}, 0xe1f0},
+	}
+	for _, test := range tests {
+		if crc := crc16CCITT(test.data); crc != test.crc {
+			t.Errorf("crc16CCITT(%q) = %04x, want %04x", test.data, crc, test.crc)
+		}
+	}
+}
+
+func TestComputeChecksums(t *testing.T) {
+	data := []byte("123456789")
+	tests := []struct {
+		name   string
+		start  int
+		length int
+		sums   Checksums
+	}{
+		{"complete", 0, -1, Checksums{start: 0, length: 9, sum16: 0x01dd, sum32: 0x01dd, crc16: 0x29b1, crc32: 0xcbf43926,
+			md5: "25f9e794323b453885f5181f1b624d0b", sha1: "f7c3bc1d808e04732adf679965ccc34ca7ae3441"}},
+		{"range", 2, 3, Checksums{start: 2, length: 3, sum16: 0x9c, sum32: 0x9c}},
+		{"range clipped", 7, 100, Checksums{start: 7, length: 2, sum16: 0x71, sum32: 0x71}},
+		{"start behind end", 20, -1, Checksums{start: 9, length: 0, crc16: 0xffff}},
+	}
+	for _, test := range tests {
+		sums := computeChecksums(data, test.start, test.length)
+		if sums.start != test.sums.start || sums.length != test.sums.length {
+			t.Errorf("%v: range %v:%v, want %v:%v", test.name, sums.start, sums.length, test.sums.start, test.sums.length)
+		}
+		if sums.sum16 != test.sums.sum16 || sums.sum32 != test.sums.sum32 {
+			t.Errorf("%v: sums %04x %08x, want %04x %08x", test.name, sums.sum16, sums.sum32, test.sums.sum16, test.sums.sum32)
+		}
+		if test.sums.crc16 != 0 && sums.crc16 != test.sums.crc16 {
+			t.Errorf("%v: crc16 %04x, want %04x", test.name, sums.crc16, test.sums.crc16)
+		}
+		if test.sums.crc32 != 0 && sums.crc32 != test.sums.crc32 {
+			t.Errorf("%v: crc32 %08x, want %08x", test.name, sums.crc32, test.sums.crc32)
+		}
+		if test.sums.md5 != "" && (sums.md5 != test.sums.md5 || sums.sha1 != test.sums.sha1) {
+			t.Errorf("%v: md5 %v sha1 %v", test.name, sums.md5, sums.sha1)
+		}
+	}
+}
+
+func TestSum16Overflow(t *testing.T) {
+	data := make([]byte, 0x200)
+	for i := range data {
+		data[i] = 0xff
+	}
+	sums := computeChecksums(data, 0, -1)
+	if sums.sum32 != 0x1fe00 || sums.sum16 != 0xfe00 {
+		t.Errorf("sums %08x %04x, want 0001fe00 fe00", sums.sum32, sums.sum16)
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		text   string
+		start  int
+		length int
+		ok     bool
+	}{
+		{"", 0, -1, true},
+		{"0x100:0x200", 0x100, 0x200, true},
+		{"16:32", 16, 32, true},
+		{"0x10:", 0x10, -1, true},
+		{"16", 0, -1, false},
+		{"x:1", 0, -1, false},
+		{"1:y", 0, -1, false},
+		{"1:2:3", 0, -1, false},
+	}
+	for _, test := range tests {
+		start, length, err := parseRange(test.text)
+		if (err == nil) != test.ok || start != test.start || length != test.length {
+			t.Errorf("parseRange(%q) = %v, %v, %v", test.text, start, length, err)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Named commands (blank, program, format hp64k, ...) are entered in line mode or with ': n'. Device commands
+// are translated to keys by the keypad mapping table, which mirrors docs/remote-keypad.png.
+
+// KeypadKey key of EPrommer's keypad and key of computer keyboard sent for it in remote control
+type KeypadKey struct {
+	name  string // name used in commands, e.g. "DEVICE"
+	label string // label on keypad
+	key   byte
+}
+
+// keypad keys of EPrommer's keypad, 0-9 and A-F are hex digits, too
+var keypad = []KeypadKey{
+	{name: "DEVICE", label: "DEVICE", key: 'P'},
+	{name: "FUNCTION", label: "FUNCTION", key: 'U'},
+	{name: "ROMTYPE", label: "ROM TYPE", key: 'R'},
+	{name: "EDIT", label: "EDIT", key: 'T'},
+	{name: "DOWN", label: "▼", key: '/'},
+	{name: "UP", label: "▲", key: ' '},
+	{name: "SET", label: "SET", key: '\r'},
+	{name: "RESET", label: "RESET", key: '@'},
+	{name: "SETP", label: "SETP", key: 'S'},
+	{name: "COPY", label: "A / COPY", key: 'A'},
+	{name: "ERASE", label: "B / ERASE", key: 'B'},
+	{name: "BLANK", label: "C / BLANK", key: 'C'},
+	{name: "PROGRAM", label: "D / PROGRAM", key: 'D'},
+	{name: "VERIFY", label: "E / VERIFY", key: 'E'},
+	{name: "BPV", label: "F / B.P.V.", key: 'F'},
+}
+
+// keypadKeys returns keys to send for keypad keys names, e.g. "DEVICE BLANK SET" -> "PC\r".
+// Hex digits stand for themselves.
+func keypadKeys(names ...string) (string, error) {
+	sb := new(strings.Builder)
+	for _, name := range names {
+		key, found := findKeypadKey(name)
+		if !found {
+			return "", fmt.Errorf("unknown key %v", name)
+		}
+		sb.WriteByte(key)
+	}
+	return sb.String(), nil
+}
+
+// findKeypadKey returns key sent for keypad key name or hex digit
+func findKeypadKey(name string) (byte, bool) {
+	upper := strings.ToUpper(name)
+	for _, k := range keypad {
+		if k.name == upper {
+			return k.key, true
+		}
+	}
+	if len(upper) == 1 && strings.Contains("0123456789ABCDEF", upper) {
+		return upper[0], true
+	}
+	return 0, false
+}
+
+// NamedCommand command of command language
+type NamedCommand struct {
+	name string
+	args string   // arguments shown in help, e.g. "[name]"
+	keys []string // keypad keys of device commands, nil for other commands
+	help string
+	run  func(ando *AndoConnection, consoleReader *bufio.Reader, args []string)
+}
+
+// namedCommands all named commands, sorted by name when initialized
+var namedCommands []NamedCommand
+
+func init() {
+	namedCommands = []NamedCommand{
+		{name: "blank", keys: []string{"DEVICE", "BLANK", "SET"}, help: "blank check of socket EPROM"},
+		{name: "program", keys: []string{"DEVICE", "PROGRAM", "SET"}, help: "program socket EPROM from RAM buffer"},
+		{name: "verify", keys: []string{"DEVICE", "VERIFY", "SET"}, help: "verify socket EPROM against RAM buffer"},
+		{name: "copy", keys: []string{"DEVICE", "COPY", "SET"}, help: "copy socket EPROM into RAM buffer"},
+		{name: "bpv", keys: []string{"DEVICE", "BPV", "SET"}, help: "blank check, program and verify"},
+		{name: "erase", keys: []string{"DEVICE", "ERASE", "SET"}, help: "erase socket device (electrically erasable types)"},
+		{name: "reset", help: "RESET (@)", run: runReset},
+		{name: "romtype", args: "[name]", help: "show or select ROM type (ROMTYPE UP / ROMTYPE <code> SET)", run: runRomType},
+		{name: "format", args: "[ascii-hex|hp64k|generic]", help: "show or select transfer format (FUNCTION 5 <id> SET)", run: runFormat},
+		{name: "keys", args: "<key>...", help: "send keypad keys, e.g. keys DEVICE BLANK SET", run: runKeys},
+		{name: "download", help: "download EPROM data (: d)", run: compoundRunner('d')},
+		{name: "upload", help: "upload file to EPrommer (: u)", run: compoundRunner('u')},
+		{name: "write", help: "write EPROM data to file (: w)", run: compoundRunner('w')},
+		{name: "compare", help: "compare downloaded data with reference file (: c)", run: compoundRunner('c')},
+		{name: "verify-file", help: "verify RAM buffer against file on device (: v)", run: compoundRunner('v')},
+		{name: "burn", help: "blank check, upload, program and verify file (: b)", run: compoundRunner('b')},
+		{name: "program-check", help: "check whether file can be programmed over chip (: p)", run: compoundRunner('p')},
+		{name: "edit", help: "edit downloaded data in hex editor (: e)", run: compoundRunner('e')},
+		{name: "diff", help: "show differences between a file and downloaded data (: x)", run: compoundRunner('x')},
+		{name: "quit", help: "quit (: q)", run: compoundRunner('q')},
+		{name: "help", help: "list named commands and keypad keys", run: runCommandHelp},
+	}
+	sort.Slice(namedCommands, func(i, j int) bool { return namedCommands[i].name < namedCommands[j].name })
+}
+
+// findNamedCommand returns named command, nil if name is unknown
+func findNamedCommand(name string) *NamedCommand {
+	for i := range namedCommands {
+		if namedCommands[i].name == strings.ToLower(name) {
+			return &namedCommands[i]
+		}
+	}
+	return nil
+}
+
+// runNamedCommand runs line if it starts with a named command. Returns false if it does not.
+func runNamedCommand(ando *AndoConnection, consoleReader *bufio.Reader, line string) bool {
+	words := strings.Fields(line)
+	if len(words) == 0 {
+		return false
+	}
+	command := findNamedCommand(words[0])
+	if command == nil {
+		return false
+	}
+	if command.run != nil {
+		command.run(ando, consoleReader, words[1:])
+		return true
+	}
+	keys, _ := keypadKeys(command.keys...)
+	logf(ando, "%v (%v)\n\r", command.name, strings.Join(command.keys, " "))
+	if deviceCommand(ando, keys) {
+		logf(ando, "%v PASSED\n\r", command.name)
+	} else {
+		logf(ando, "%v FAILED [%v]\n\r", command.name, ando.lastReply)
+	}
+	return true
+}
+
+// compoundRunner returns run function executing compound command key
+func compoundRunner(key byte) func(ando *AndoConnection, consoleReader *bufio.Reader, args []string) {
+	return func(ando *AndoConnection, consoleReader *bufio.Reader, args []string) {
+		compoundCommand(ando, consoleReader, key)
+	}
+}
+
+// runReset sends RESET
+func runReset(ando *AndoConnection, consoleReader *bufio.Reader, args []string) {
+	keys, _ := keypadKeys("RESET")
+	sendKeys(ando, keys)
+	ando.state = NormalInput
+}
+
+// runRomType shows ROM type selected on EPrommer or selects ROM type
+func runRomType(ando *AndoConnection, consoleReader *bufio.Reader, args []string) {
+	if len(args) == 0 {
+		updateRomType(ando)
+		logf(ando, "ROM type: %v\n\r", romTypeName(ando))
+		return
+	}
+	selectRomType(ando, args[0])
+}
+
+// runFormat shows or selects transfer format
+func runFormat(ando *AndoConnection, consoleReader *bufio.Reader, args []string) {
+	if len(args) == 0 {
+		logf(ando, "Transfer format: %v\n\r", ando.transferFormat)
+		return
+	}
+	format, ok := parseTransferFormat(args[0])
+	if !ok {
+		logf(ando, "Unknown transfer format %v, known are ascii-hex, hp64k and generic\n\r", args[0])
+		return
+	}
+	selectTransferFormat(ando, format)
+	logf(ando, "Transfer format is now %v\n\r", ando.transferFormat)
+}
+
+// runKeys sends keypad keys given by name
+func runKeys(ando *AndoConnection, consoleReader *bufio.Reader, args []string) {
+	keys, err := keypadKeys(args...)
+	if err != nil {
+		logf(ando, "%s\n\r", err)
+		return
+	}
+	sendKeys(ando, keys)
+}
+
+// runCommandHelp prints named commands and keypad mapping table
+func runCommandHelp(ando *AndoConnection, consoleReader *bufio.Reader, args []string) {
+	fmt.Print("Named commands:\n\r")
+	for _, command := range namedCommands {
+		help := command.help
+		if command.keys != nil {
+			help += " (" + strings.Join(command.keys, " ") + ")"
+		}
+		fmt.Printf(" %-33v %v\n\r", strings.TrimSpace(command.name+" "+command.args), help)
+	}
+	fmt.Print("Keypad keys:\n\r")
+	for _, k := range keypad {
+		fmt.Printf(" %-10v %-12v %q\n\r", k.name, k.label, k.key)
+	}
+	fmt.Print(" 0-9, A-F   hex digits\n\r")
+}
+
+// completeCommand returns candidates for word of a line in line mode, words are the words before it
+func completeCommand(words []string, word string) []string {
+	var names []string
+	if len(words) == 0 {
+		for _, command := range namedCommands {
+			names = append(names, command.name)
+		}
+	} else {
+		switch strings.ToLower(words[0]) {
+		case "romtype":
+			if len(words) == 1 {
+				for _, romType := range romTypes {
+					names = append(names, romType.name)
+				}
+			}
+		case "format":
+			if len(words) == 1 {
+				names = []string{"ascii-hex", "hp64k", "generic"}
+			}
+		case "keys":
+			for _, k := range keypad {
+				names = append(names, k.name)
+			}
+		}
+	}
+	var candidates []string
+	for _, name := range names {
+		if strings.HasPrefix(strings.ToLower(name), strings.ToLower(word)) {
+			candidates = append(candidates, name)
+		}
+	}
+	return candidates
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestKeypadKeys(t *testing.T) {
+	tests := []struct {
+		names []string
+		keys  string
+		err   bool
+	}{
+		{[]string{"DEVICE", "BLANK", "SET"}, "PC\r", false},
+		{[]string{"device", "program", "set"}, "PD\r", false},
+		{[]string{"ROMTYPE", "UP"}, "R ", false},
+		{[]string{"FUNCTION", "5", "a", "SET"}, "U5A\r", false},
+		{[]string{"RESET"}, "@", false},
+		{[]string{"DEVICE", "G"}, "", true},
+		{[]string{"DEVICE", "10"}, "", true},
+		{nil, "", false},
+	}
+	for _, test := range tests {
+		keys, err := keypadKeys(test.names...)
+		if keys != test.keys || (err != nil) != test.err {
+			t.Errorf("keypadKeys(%v) = %q, %v, want %q, error %v", test.names, keys, err, test.keys, test.err)
+		}
+	}
+}
+
+func TestFindNamedCommand(t *testing.T) {
+	tests := []struct {
+		name  string
+		found string
+	}{
+		{"blank", "blank"},
+		{"BURN", "burn"},
+		{"verify-file", "verify-file"},
+		{"bla", ""},
+	}
+	for _, test := range tests {
+		found := ""
+		if command := findNamedCommand(test.name); command != nil {
+			found = command.name
+		}
+		if found != test.found {
+			t.Errorf("findNamedCommand(%v) = %q, want %q", test.name, found, test.found)
+		}
+	}
+}
+
+func TestNamedCommandKeys(t *testing.T) {
+	for _, command := range namedCommands {
+		if command.keys == nil {
+			continue
+		}
+		if _, err := keypadKeys(command.keys...); err != nil {
+			t.Errorf("keys of %v: %v", command.name, err)
+		}
+	}
+}
+
+func TestCompleteCommand(t *testing.T) {
+	tests := []struct {
+		words      []string
+		word       string
+		candidates []string
+	}{
+		{nil, "bu", []string{"burn"}},
+		{nil, "B", []string{"blank", "bpv", "burn"}},
+		{nil, "x", nil},
+		{[]string{"format"}, "h", []string{"hp64k"}},
+		{[]string{"format", "hp64k"}, "", nil},
+		{[]string{"romtype"}, "271", []string{"2716", "27128", "27128A"}},
+		{[]string{"keys", "DEVICE"}, "b", []string{"BLANK", "BPV"}},
+		{[]string{"blank"}, "", nil},
+	}
+	for _, test := range tests {
+		candidates := completeCommand(test.words, test.word)
+		if !reflect.DeepEqual(candidates, test.candidates) {
+			t.Errorf("completeCommand(%v, %q) = %v, want %v", test.words, test.word, candidates, test.candidates)
+		}
+	}
+}
+
+func TestRunNamedCommand(t *testing.T) {
+	tests := []struct {
+		line    string
+		handled bool
+		keys    string
+	}{
+		{"keys DEVICE BLANK SET", true, "PC\r"},
+		{"KEYS romtype up", true, "R "},
+		{"keys DEVICE X", true, ""},
+		{"reset", true, "@"},
+		{"P D", false, ""},
+		{"", false, ""},
+	}
+	for _, test := range tests {
+		ando, tty := newFakeSession(nil)
+		if handled := runNamedCommand(ando, nil, test.line); handled != test.handled {
+			t.Errorf("runNamedCommand(%q) = %v, want %v", test.line, handled, test.handled)
+		}
+		if keys := tty.written.String(); keys != test.keys {
+			t.Errorf("runNamedCommand(%q) sent %q, want %q", test.line, keys, test.keys)
+		}
+	}
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// DiffRange a range of addresses [start, end) with differing bytes
+type DiffRange struct {
+	start int
+	end   int
+	count int // number of differing bytes in range
+}
+
+// DiffResult result of comparing two images (a: e.g. reference, b: e.g. data read from EPrommer)
+type DiffResult struct {
+	sizeA      int
+	sizeB      int
+	differing  int         // number of differing bytes, including bytes missing in one image
+	ranges     []DiffRange // differing ranges, ranges closer than diffRangeGap are merged
+	bitsSet    int         // bits 0 in a and 1 in b
+	bitsClear  int         // bits 1 in a and 0 in b
+	bitFlips   [8]int      // flipped bits per data line D0..D7
+	onlyInA    int         // bytes beyond end of b
+	onlyInB    int         // bytes beyond end of a
+	commonSize int         // number of bytes compared
+}
+
+// diffRangeGap differing bytes with less identical bytes in between are reported as one range
+const diffRangeGap = 8
+
+// diffBytesPerRow bytes per side in side-by-side hex view
+const diffBytesPerRow = 8
+
+// diffImages compares image a with image b address by address
+func diffImages(a []byte, b []byte) DiffResult {
+	result := DiffResult{sizeA: len(a), sizeB: len(b)}
+	result.commonSize = len(a)
+	if len(b) < result.commonSize {
+		result.commonSize = len(b)
+	}
+	addDiff := func(address int) {
+		result.differing++
+		last := len(result.ranges) - 1
+		if last >= 0 && address-result.ranges[last].end < diffRangeGap {
+			result.ranges[last].end = address + 1
+			result.ranges[last].count++
+			return
+		}
+		result.ranges = append(result.ranges, DiffRange{address, address + 1, 1})
+	}
+	for i := 0; i < result.commonSize; i++ {
+		if a[i] == b[i] {
+			continue
+		}
+		addDiff(i)
+		for bit := 0; bit < 8; bit++ {
+			mask := byte(1 << bit)
+			if a[i]&mask == b[i]&mask {
+				continue
+			}
+			result.bitFlips[bit]++
+			if b[i]&mask != 0 {
+				result.bitsSet++
+			} else {
+				result.bitsClear++
+			}
+		}
+	}
+	if len(a) > result.commonSize {
+		result.onlyInA = len(a) - result.commonSize
+	}
+	if len(b) > result.commonSize {
+		result.onlyInB = len(b) - result.commonSize
+	}
+	result.differing += result.onlyInA + result.onlyInB
+	return result
+}
+
+// identical returns true if both images have same size and content
+func (result *DiffResult) identical() bool {
+	return result.differing == 0
+}
+
+// bitRotAnalysis describes pattern of flipped bits
+func (result *DiffResult) bitRotAnalysis() string {
+	switch {
+	case result.bitsSet == 0 && result.bitsClear == 0:
+		return "no bits flipped"
+	case result.bitsClear == 0:
+		return "all flipped bits went 0 -> 1 only: typical of a fading EPROM (bit-rot), the chip should be reprogrammed"
+	case result.bitsSet == 0:
+		return "all flipped bits went 1 -> 0 only: second image has additional bits programmed"
+	}
+	return "bits flipped in both directions: images differ in content, no bit-rot pattern"
+}
+
+// printDiffResult prints differing ranges, side-by-side hex of the first maxRanges ranges and bit-rot analysis
+func printDiffResult(ando *AndoConnection, result DiffResult, a []byte, b []byte, nameA string, nameB string, maxRanges int) {
+	fmt.Printf("A: %v (%v bytes)\n\rB: %v (%v bytes)\n\r", nameA, result.sizeA, nameB, result.sizeB)
+	if result.identical() {
+		logf(ando, "Images are identical\n\r")
+		return
+	}
+	fmt.Printf("Range              Bytes\n\r")
+	for _, r := range result.ranges {
+		fmt.Printf("%08x-%08x  %v\n\r", r.start, r.end-1, r.count)
+	}
+	if result.onlyInA > 0 {
+		fmt.Printf("%08x-%08x  %v (only in A)\n\r", result.commonSize, result.sizeA-1, result.onlyInA)
+	}
+	if result.onlyInB > 0 {
+		fmt.Printf("%08x-%08x  %v (only in B)\n\r", result.commonSize, result.sizeB-1, result.onlyInB)
+	}
+	for i, r := range result.ranges {
+		if i >= maxRanges {
+			fmt.Printf("... %v more ranges\n\r", len(result.ranges)-maxRanges)
+			break
+		}
+		fmt.Printf("\n\r")
+		for row := r.start / diffBytesPerRow * diffBytesPerRow; row < r.end; row += diffBytesPerRow {
+			fmt.Printf("%v\n\r", diffRow(a, b, row, false))
+			fmt.Printf("%v\n\r", diffMarkerRow(a, b, row))
+		}
+	}
+	fmt.Printf("\n\rBit flips A -> B: %v 0->1, %v 1->0, per data line D0..D7: %v\n\r", result.bitsSet, result.bitsClear, result.bitFlips)
+	logf(ando, "%v bytes differ in %v ranges, %v\n\r", result.differing, len(result.ranges), result.bitRotAnalysis())
+}
+
+// diffRow formats a row of side-by-side hex view, differing bytes are highlighted if highlight is set
+func diffRow(a []byte, b []byte, address int, highlight bool) string {
+	sb := new(strings.Builder)
+	fmt.Fprintf(sb, "%08x  ", address)
+	for side, image := range [][]byte{a, b} {
+		other := [][]byte{b, a}[side]
+		ascii := new(strings.Builder)
+		for i := address; i < address+diffBytesPerRow; i++ {
+			if i >= len(image) {
+				sb.WriteString("   ")
+				ascii.WriteString(" ")
+				continue
+			}
+			c := byte('.')
+			if image[i] >= 0x20 && image[i] < 0x7f {
+				c = image[i]
+			}
+			if highlight && (i >= len(other) || image[i] != other[i]) {
+				fmt.Fprintf(sb, "\x1b[1;31m%02x\x1b[0m ", image[i])
+				fmt.Fprintf(ascii, "\x1b[1;31m%c\x1b[0m", c)
+			} else {
+				fmt.Fprintf(sb, "%02x ", image[i])
+				ascii.WriteByte(c)
+			}
+		}
+		fmt.Fprintf(sb, "|%v|", ascii.String())
+		if side == 0 {
+			sb.WriteString("  ")
+		}
+	}
+	return sb.String()
+}
+
+// diffMarkerRow formats a line marking differing bytes of a diffRow with '^'
+func diffMarkerRow(a []byte, b []byte, address int) string {
+	marks := new(strings.Builder)
+	for i := address; i < address+diffBytesPerRow; i++ {
+		if (i < len(a) || i < len(b)) && (i >= len(a) || i >= len(b) || a[i] != b[i]) {
+			marks.WriteString("^^ ")
+		} else {
+			marks.WriteString("   ")
+		}
+	}
+	side := marks.String() + strings.Repeat(" ", diffBytesPerRow+2)
+	return strings.TrimRight(strings.Repeat(" ", 10)+side+"  "+side, " ")
+}
+
+// diffFiles compares two image files. Returns true if they are identical.
+func diffFiles(ando *AndoConnection, fileA string, fileB string) bool {
+	a, err := loadImage(fileA)
+	if err != nil {
+		logf(ando, "Error loading file %s: %s\n\r", fileA, err)
+		return false
+	}
+	b, err := loadImage(fileB)
+	if err != nil {
+		logf(ando, "Error loading file %s: %s\n\r", fileB, err)
+		return false
+	}
+	result := diffImages(a, b)
+	printDiffResult(ando, result, a, b, fileA, fileB, ando.maxDiffs)
+	return result.identical()
+}
+
+// diffDownload compares file with data downloaded last. Returns true if they are identical.
+func diffDownload(ando *AndoConnection, filename string) bool {
+	a, err := loadImage(filename)
+	if err != nil {
+		logf(ando, "Error loading file %s: %s\n\r", filename, err)
+		return false
+	}
+	b := downloadedImage(ando)
+	result := diffImages(a, b)
+	printDiffResult(ando, result, a, b, filename, "EPrommer RAM buffer", ando.maxDiffs)
+	return result.identical()
+}
+
+// runDiffViewer asks for a file and shows it side by side with data downloaded last in a full-screen view
+func runDiffViewer(ando *AndoConnection, consoleReader *bufio.Reader) {
+	if len(ando.lineInfos) == 0 {
+		logf(ando, "No data downloaded yet, nothing to compare\n\r")
+		return
+	}
+	filename := readInputLine(consoleReader, fmt.Sprintf("\n\rCompare with file [%v] > ", ando.referenceFile))
+	if filename == "" {
+		filename = ando.referenceFile
+	}
+	a, err := loadImage(filename)
+	if err != nil {
+		logf(ando, "Error loading file %s: %s\n\r", filename, err)
+		return
+	}
+	b := downloadedImage(ando)
+	result := diffImages(a, b)
+	if result.identical() {
+		logf(ando, "Images are identical\n\r")
+		return
+	}
+
+	previousState := ando.state
+	ando.state = Editing
+	defer func() {
+		ando.state = previousState
+		fmt.Fprint(terminalOutput, "\x1b[2J\x1b[H")
+		logf(ando, "%v bytes differ in %v ranges, %v\n\r", result.differing, len(result.ranges), result.bitRotAnalysis())
+	}()
+	size := len(a)
+	if len(b) > size {
+		size = len(b)
+	}
+	lastRow := (size - 1) / diffBytesPerRow
+	top := 0
+	current := 0
+	if len(result.ranges) > 0 {
+		top = result.ranges[0].start / diffBytesPerRow
+	} else {
+		top = result.commonSize / diffBytesPerRow
+	}
+	for {
+		_, height, err := term.GetSize(int(os.Stdin.Fd()))
+		if err != nil || height < 6 {
+			height = 24
+		}
+		rows := height - 4
+		if top > lastRow-rows+1 {
+			top = lastRow - rows + 1
+		}
+		if top < 0 {
+			top = 0
+		}
+		sb := new(strings.Builder)
+		sb.WriteString("\x1b[2J\x1b[H")
+		fmt.Fprintf(sb, "\x1b[7m A: %v  B: EPrommer RAM buffer  %v bytes differ in %v ranges \x1b[0m\r\n",
+			filename, result.differing, len(result.ranges))
+		for row := top; row < top+rows; row++ {
+			if row <= lastRow {
+				sb.WriteString(diffRow(a, b, row*diffBytesPerRow, true))
+			}
+			sb.WriteString("\r\n")
+		}
+		fmt.Fprintf(sb, "%v\r\n", result.bitRotAnalysis())
+		sb.WriteString("\x1b[2marrows/PgUp/PgDn/Home/End scroll  n next range  p previous range  q quit\x1b[0m")
+		fmt.Fprint(terminalOutput, sb.String())
+
+		key, err := consoleReader.ReadByte()
+		if err != nil {
+			return
+		}
+		if key == 0x1b {
+			if consoleReader.Buffered() == 0 {
+				return
+			}
+			key = readCursorKey(consoleReader)
+		}
+		switch key {
+		case 'q', 0x3, 0x18:
+			return
+		case 'A':
+			top--
+		case 'B':
+			top++
+		case '5':
+			top -= rows
+		case '6':
+			top += rows
+		case 'H':
+			top = 0
+		case 'F':
+			top = lastRow
+		case 'n', 'p':
+			if len(result.ranges) == 0 {
+				continue
+			}
+			if key == 'n' && current < len(result.ranges)-1 {
+				current++
+			}
+			if key == 'p' && current > 0 {
+				current--
+			}
+			top = result.ranges[current].start / diffBytesPerRow
+		}
+	}
+}
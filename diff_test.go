@@ -0,0 +1,66 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffImages(t *testing.T) {
+	tests := []struct {
+		name      string
+		a         []byte
+		b         []byte
+		differing int
+		ranges    []DiffRange
+		bitsSet   int
+		bitsClear int
+		analysis  string
+	}{
+		{"identical", []byte{1, 2, 3}, []byte{1, 2, 3}, 0, nil, 0, 0, "no bits flipped"},
+		{"bit-rot", []byte{0x00, 0x10, 0x20}, []byte{0x01, 0x10, 0x21}, 2, []DiffRange{{0, 3, 2}}, 2, 0, "bit-rot"},
+		{"programmed bits", []byte{0xff, 0xff}, []byte{0xfe, 0xff}, 1, []DiffRange{{0, 1, 1}}, 0, 1, "additional bits"},
+		{"both directions", []byte{0x0f}, []byte{0xf0}, 1, []DiffRange{{0, 1, 1}}, 4, 4, "both directions"},
+		{"separate ranges", make([]byte, 20), append(append([]byte{1}, make([]byte, 18)...), 1), 2,
+			[]DiffRange{{0, 1, 1}, {19, 20, 1}}, 2, 0, "bit-rot"},
+		{"b shorter", []byte{1, 2, 3, 4}, []byte{1, 2}, 2, nil, 0, 0, "no bits flipped"},
+		{"b longer", []byte{1}, []byte{1, 2, 3}, 2, nil, 0, 0, "no bits flipped"},
+	}
+	for _, test := range tests {
+		result := diffImages(test.a, test.b)
+		if result.differing != test.differing || !reflect.DeepEqual(result.ranges, test.ranges) {
+			t.Errorf("%v: %v differing in %v, want %v in %v", test.name, result.differing, result.ranges, test.differing, test.ranges)
+		}
+		if result.bitsSet != test.bitsSet || result.bitsClear != test.bitsClear {
+			t.Errorf("%v: bits set %v clear %v, want %v %v", test.name, result.bitsSet, result.bitsClear, test.bitsSet, test.bitsClear)
+		}
+		if !strings.Contains(result.bitRotAnalysis(), test.analysis) {
+			t.Errorf("%v: analysis %q", test.name, result.bitRotAnalysis())
+		}
+		if result.identical() != (test.differing == 0) {
+			t.Errorf("%v: identical() is %v", test.name, result.identical())
+		}
+	}
+}
+
+func TestDiffBitFlipsPerLine(t *testing.T) {
+	result := diffImages([]byte{0x00, 0x00, 0x80}, []byte{0x01, 0x81, 0x00})
+	want := [8]int{2, 0, 0, 0, 0, 0, 0, 2}
+	if result.bitFlips != want {
+		t.Errorf("bit flips %v, want %v", result.bitFlips, want)
+	}
+}
+
+func TestDiffRows(t *testing.T) {
+	a := []byte("ABCDEFGH")
+	b := []byte("ABXDEFG")
+	row := diffRow(a, b, 0, false)
+	if !strings.HasPrefix(row, "00000000  41 42 43 44 45 46 47 48 |ABCDEFGH|  41 42 58 44 45 46 47    |ABXDEFG |") {
+		t.Errorf("diffRow = %q", row)
+	}
+	// C/X at 2 and H missing in b at 7 are marked on both sides
+	side := "      ^^             ^^"
+	if marks := diffMarkerRow(a, b, 0); marks != strings.Repeat(" ", 10)+side+strings.Repeat(" ", 13)+side {
+		t.Errorf("diffMarkerRow = %q", marks)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+)
+
+// FirmwareProfile behavior of an EPrommer firmware in up- and download
+type FirmwareProfile struct {
+	name             string           // firmware version, e.g. "21.9"
+	info             string           // devices this firmware is found on
+	headerLines      int              // number of CR LF before ASCII-Hex download header zeroes
+	headerZeroes     int              // (minimum) number of 0x0 bytes in ASCII-Hex download header
+	footerZeroes     int              // (minimum) number of 0x0 bytes in ASCII-Hex download footer
+	recordEnd        byte             // last char of a record line in ASCII-Hex downloads
+	uploadLineEnding string           // line ending of records in ASCII-Hex uploads
+	hp64kEndOfFile   bool             // HP64000ABS upload ends with End-Of-File record
+	formats          []TransferFormat // transfer formats supported by this app for this firmware
+	quirks           string           // known quirks
+	guesses          string           // values not measured on a device, "" if all are measured
+}
+
+// Header and footer zeroes of both firmwares have been analyzed from download data, the Promac manual
+// (which describes 21.9) says always 100 zeroes (page 28) and that no End-Of-File record is understood
+// in HP64000ABS. As the framing is the same and the firmware has no version reply, a download does not
+// tell the firmwares apart and the firmware has to be selected with --firmware (default 21.9).
+var firmwareProfiles = []FirmwareProfile{
+	FirmwareProfile{
+		name:             "21.9",
+		info:             "Promac Model 2A, Ando AF-9704 upgraded with Promac firmware",
+		headerLines:      3,
+		headerZeroes:     52,
+		footerZeroes:     99,
+		recordEnd:        0xa,
+		uploadLineEnding: "\r",
+		hp64kEndOfFile:   false,
+		formats:          []TransferFormat{F_ASCIIHex, F_HP64000ABS, F_GENERIC},
+		quirks:           "less header and footer zeroes than the 100 documented in manual, no HP64000ABS End-Of-File record",
+	},
+	FirmwareProfile{
+		name:             "21.7",
+		info:             "Original Ando AF-9704",
+		headerLines:      3,
+		headerZeroes:     52,
+		footerZeroes:     99,
+		recordEnd:        0xa,
+		uploadLineEnding: "\r",
+		hp64kEndOfFile:   true,
+		formats:          []TransferFormat{F_ASCIIHex, F_HP64000ABS, F_GENERIC},
+		quirks:           "same ASCII-Hex download framing as 21.9",
+		guesses:          "record line endings and HP64000ABS taken over from 21.9, End-Of-File record as in HP64000ABS standard",
+	},
+}
+
+// defaultFirmwareProfile is used if no firmware was selected
+var defaultFirmwareProfile = &firmwareProfiles[0]
+
+// findFirmwareProfile returns profile for firmware version name, nil if unknown
+func findFirmwareProfile(name string) *FirmwareProfile {
+	for i, profile := range firmwareProfiles {
+		if profile.name == name {
+			return &firmwareProfiles[i]
+		}
+	}
+	return nil
+}
+
+// currentFirmwareProfile returns profile selected, default profile if there is none
+func currentFirmwareProfile(ando *AndoConnection) *FirmwareProfile {
+	if ando.firmware == nil {
+		return defaultFirmwareProfile
+	}
+	return ando.firmware
+}
+
+// firmwareName returns name of selected firmware, "unknown" if there is none
+func firmwareName(ando *AndoConnection) string {
+	if ando.firmware == nil {
+		return "unknown"
+	}
+	return ando.firmware.name
+}
+
+// supportsFormat returns true if transfer format is supported for firmware
+func (profile *FirmwareProfile) supportsFormat(format TransferFormat) bool {
+	for _, f := range profile.formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// countHeaderZeroes counts 0x0 bytes after the CR LF lines at start of ASCII-Hex download data
+func countHeaderZeroes(data []byte) int {
+	i := 0
+	for i+1 < len(data) && data[i] == 0xd && data[i+1] == 0xa {
+		i += 2
+	}
+	zeroes := 0
+	for ; i < len(data) && data[i] == 0x0; i++ {
+		zeroes++
+	}
+	return zeroes
+}
+
+// countFooterZeroes counts 0x0 bytes before the final CR LF of ASCII-Hex download data
+func countFooterZeroes(data []byte) int {
+	i := len(data) - 1
+	for i > 0 && data[i] != 0xa {
+		i--
+	}
+	// skip CR LF
+	i -= 2
+	zeroes := 0
+	for ; i >= 0 && data[i] == 0x0; i-- {
+		zeroes++
+	}
+	return zeroes
+}
+
+// logFirmwareFraming logs header and footer zeroes of ASCII-Hex download data, which differ from the
+// firmware profile if the EPrommer runs another firmware than selected
+func logFirmwareFraming(ando *AndoConnection, data []byte) {
+	profile := currentFirmwareProfile(ando)
+	headerZeroes := countHeaderZeroes(data)
+	footerZeroes := countFooterZeroes(data)
+	logf(ando, "Download has %v header and %v footer zero bytes\n\r", headerZeroes, footerZeroes)
+	if headerZeroes < profile.headerZeroes || footerZeroes < profile.footerZeroes {
+		logf(ando, "Warning: firmware %v sends at least %v header and %v footer zero bytes, check --firmware\n\r",
+			profile.name, profile.headerZeroes, profile.footerZeroes)
+	}
+}
+
+// String returns a description of firmware profile
+func (profile FirmwareProfile) String() string {
+	if profile.guesses != "" {
+		return fmt.Sprintf("%v (%v; %v; guessed: %v)", profile.name, profile.info, profile.quirks, profile.guesses)
+	}
+	return fmt.Sprintf("%v (%v; %v)", profile.name, profile.info, profile.quirks)
+}
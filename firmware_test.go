@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+// asciiHexDownload returns ASCII-Hex download data framed like sent by EPrommer
+func asciiHexDownload(lines int, headerZeroes int, footerZeroes int, records string) []byte {
+	data := bytes.Repeat([]byte("\r\n"), lines)
+	data = append(data, make([]byte, headerZeroes)...)
+	data = append(data, records...)
+	data = append(data, make([]byte, footerZeroes)...)
+	return append(data, "\r\n"...)
+}
+
+func TestCountZeroes(t *testing.T) {
+	tests := []struct {
+		data   []byte
+		header int
+		footer int
+	}{
+		{asciiHexDownload(3, 52, 99, "[#00000000,01,\r\n]"), 52, 99},
+		{asciiHexDownload(3, 100, 100, "[]"), 100, 100},
+		{asciiHexDownload(0, 0, 0, "x"), 0, 0},
+	}
+	for _, test := range tests {
+		if header := countHeaderZeroes(test.data); header != test.header {
+			t.Errorf("countHeaderZeroes(%q) = %v, want %v", test.data, header, test.header)
+		}
+		if footer := countFooterZeroes(test.data); footer != test.footer {
+			t.Errorf("countFooterZeroes(%q) = %v, want %v", test.data, footer, test.footer)
+		}
+	}
+}
+
+func TestLogFirmwareFraming(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	tests := []struct {
+		firmware string
+		header   int
+		footer   int
+		warning  bool
+	}{
+		{"21.9", 52, 99, false},
+		{"21.7", 52, 99, false},
+		{"21.9", 100, 100, false},
+		{"21.9", 20, 99, true},
+		{"21.7", 52, 20, true},
+	}
+	for _, test := range tests {
+		buf.Reset()
+		ando := &AndoConnection{firmware: findFirmwareProfile(test.firmware)}
+		logFirmwareFraming(ando, asciiHexDownload(3, test.header, test.footer, "[]"))
+		if warning := strings.Contains(buf.String(), "Warning"); warning != test.warning {
+			t.Errorf("%v with %v/%v zeroes logged %q, warning expected %v", test.firmware, test.header,
+				test.footer, buf.String(), test.warning)
+		}
+	}
+}
+
+func TestASCIIHexFraming(t *testing.T) {
+	profile := &firmwareProfiles[0]
+	data := asciiHexDownload(3, 52, 99, "[#00000000,01,\r\n]")
+	valid, start := isRawHeaderASCIIHex(data, profile)
+	if !valid || start != 6+52 {
+		t.Errorf("header valid %v, data start %v", valid, start)
+	}
+	valid, _ = isRawFooterASCIIHex(data, profile)
+	if !valid {
+		t.Errorf("footer not valid")
+	}
+	if valid, _ := isRawHeaderASCIIHex(asciiHexDownload(3, 20, 99, "[]"), profile); valid {
+		t.Errorf("header with 20 zeroes is valid")
+	}
+	if valid, _ := isRawFooterASCIIHex(asciiHexDownload(3, 52, 20, "[]"), profile); valid {
+		t.Errorf("footer with 20 zeroes is valid")
+	}
+}
+
+func TestHp64KEndOfFile(t *testing.T) {
+	for _, profile := range firmwareProfiles {
+		data := encodeHp64K([]byte{1, 2, 3}, 0, &profile)
+		hasEndOfFile := data[len(data)-1] == 0x0
+		if hasEndOfFile != profile.hp64kEndOfFile {
+			t.Errorf("firmware %v: End-Of-File record %v, want %v", profile.name, hasEndOfFile, profile.hp64kEndOfFile)
+		}
+	}
+	if findFirmwareProfile("21.9").hp64kEndOfFile {
+		t.Errorf("21.9 sends End-Of-File record, the Promac manual says it does not understand it")
+	}
+}
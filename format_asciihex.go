@@ -5,33 +5,34 @@ import (
 	"log"
 	"strconv"
 	"strings"
-	"time"
 )
 
 // parseASCIIHexFormat parses ASCII Hex transfer format data
 func parseASCIIHexFormat(ando *AndoConnection, lineNumber *int, errors *int) {
-	log.Printf("Parsing ASCII-Hex format\n\r")
-	valid, dataStart := isRawHeaderASCIIHex(genericState.rawData)
+	logf(ando, "Parsing ASCII-Hex format\n\r")
+	logFirmwareFraming(ando, ando.generic.rawData)
+	profile := currentFirmwareProfile(ando)
+	valid, dataStart := isRawHeaderASCIIHex(ando.generic.rawData, profile)
 	if !valid {
-		log.Printf("Not a ASCII-Hex header!\n\r")
+		logf(ando, "Not a ASCII-Hex header!\n\r")
 		*errors++
 	}
-	valid, dataEnd := isRawFooterASCIIHex(genericState.rawData)
+	valid, dataEnd := isRawFooterASCIIHex(ando.generic.rawData, profile)
 	if !valid {
-		log.Printf("Not a ASCII-Hex footer!\n\r")
+		logf(ando, "Not a ASCII-Hex footer!\n\r")
 		*errors++
 	}
-	log.Printf("%v bytes in range %v-%v\n\r", (dataEnd - dataStart), dataStart, dataEnd)
+	logf(ando, "%v bytes in range %v-%v\n\r", (dataEnd - dataStart), dataStart, dataEnd)
 
 	var lineBytes []byte
 	i := dataStart
 	for i <= dataEnd {
-		b := genericState.rawData[i]
+		b := ando.generic.rawData[i]
 		if b != 0xa && b != 0xd {
 			lineBytes = append(lineBytes, b)
 		}
 		i++
-		if b == 0xa {
+		if b == profile.recordEnd {
 			// We have a complete line, with address and all 16 data bytes
 			newLine := new(LineInfo)
 			newLine.lineNumber = *lineNumber
@@ -41,7 +42,7 @@ func parseASCIIHexFormat(ando *AndoConnection, lineNumber *int, errors *int) {
 				dumpLine(*newLine)
 				*lineNumber++
 			} else {
-				log.Printf("Line read fail: '%v'\n\r", string(lineBytes))
+				logf(ando, "Line read fail: '%v'\n\r", string(lineBytes))
 			}
 			lineBytes = lineBytes[:0]
 		}
@@ -96,20 +97,16 @@ func parseLine(bytes []byte, lineNumber int, lineInfo *LineInfo, errors *int, ch
 	return true
 }
 
-// uploadFileAsASCIIHex uploads local file to EPrommer's RAM buffer, transfer format being used is ASCII-Hex
-func uploadFileAsASCIIHex(ando *AndoConnection, errors *int) {
+// encodeASCIIHex encodes bytes as ASCII-Hex records, like being uploaded to EPrommer.
+// First byte goes to EPrommer's RAM buffer address offset.
+func encodeASCIIHex(bytes []byte, offset int, profile *FirmwareProfile) []byte {
 	sb := new(strings.Builder)
 	var checksum uint32 = 0
 
-	bytes, error := loadFile(ando, errors)
-	if error {
-		return
-	}
-
 	// Write prefix char
 	sb.WriteString("[")
 
-	address := 0
+	address := offset
 	i := 0
 	bytesInLine := 0
 	for i < len(bytes) {
@@ -127,47 +124,20 @@ func uploadFileAsASCIIHex(ando *AndoConnection, errors *int) {
 		i++
 		bytesInLine++
 		if bytesInLine == 16 {
-			sb.WriteString("\r")
+			sb.WriteString(profile.uploadLineEnding)
 		}
 	}
-	log.Printf("Upload data checksum: 0x%06x\n\r", checksum)
-	log.Printf("Upload buffer has size %v bytes. Please wait for upload to complete...\n\r", sb.Len())
-
-	// Send data collected
-	bbuf := make([]byte, 3)
-	bbuf[0] = 'U'
-	bbuf[1] = '6'
-	bbuf[2] = '\r'
-	ando.serial.tty.Write(bbuf)
-	// give some time to have command understood
-	time.Sleep(100 * time.Millisecond)
-
-	i = 0
-	sendString := sb.String()
-	b := make([]byte, 1)
-	for i < len(sendString) {
-		//fmt.Printf("%c\n\r", sendString[i])
-		b[0] = byte(sendString[i])
-		ando.serial.tty.Write(b)
-		i++
+	if bytesInLine > 0 && bytesInLine < 16 {
+		// terminate last, partial record
+		sb.WriteString(profile.uploadLineEnding)
 	}
-
-	// device will need some time to process all data
-	// We need to wait for "[PASS]" answer
-	// only then, the final RESET '@' we like to send will be handled by device.
-	// If we do not wait, the Programmer stays in S-INPUT mode, and we have to enter RESET via device key "RESET"
-	// or send it via "Ando/Promac EPROM Programmer Communication UI" by using the '@' key
-	// So we go to new state and wait there for incoming "[PASS]" message
-	ando.state = SendData
+	log.Printf("Upload data checksum: 0x%06x\n\r", checksum)
+	return []byte(sb.String())
 }
 
-// firmware 21.7 and 21.9
-// 52 and 99 have been analyzed from download data. The manual says always 100x zeroes (page 28)
-const NUM_HEADER_ZEROES = 52
-const NUM_FOOTER_ZEROES = 99
-
-// isRawHeaderASCIIHex returns true if this is a correct ASCII Hex transfer data header
-func isRawHeaderASCIIHex(data []byte) (bool, int) {
+// isRawHeaderASCIIHex returns true if this is a correct ASCII Hex transfer data header.
+// Number of CR LF and zero bytes depends on firmware, see firmware.go
+func isRawHeaderASCIIHex(data []byte, profile *FirmwareProfile) (bool, int) {
 	num_zeros := 0
 	/*fmt.Printf("\r\nAAAA: ")
 	for i := 0; i < 256; i++ {
@@ -177,17 +147,17 @@ func isRawHeaderASCIIHex(data []byte) (bool, int) {
 		}
 	}
 	fmt.Printf("\r\n")*/
-	if data[0] != 0xd || data[1] != 0xa {
+	headerEnd := profile.headerLines*2 + profile.headerZeroes
+	if len(data) < headerEnd {
 		return false, 0
 	}
-	if data[2] != 0xd || data[3] != 0xa {
-		return false, 0
-	}
-	if data[4] != 0xd || data[5] != 0xa {
-		return false, 0
+	var i = 0
+	for ; i < profile.headerLines*2; i += 2 {
+		if data[i] != 0xd || data[i+1] != 0xa {
+			return false, 0
+		}
 	}
-	var i = 6
-	for ; i < NUM_HEADER_ZEROES+6; i++ {
+	for ; i < headerEnd; i++ {
 		//fmt.Printf("AAAAAA %v %02x\n\r ", i, data[i])
 		if data[i] != 0x0 {
 			return false, 0
@@ -197,15 +167,15 @@ func isRawHeaderASCIIHex(data []byte) (bool, int) {
 	log.Printf("ASCII-Hex header OK\r\n")
 
 	// Overread remaining 0x0
-	for ; data[i] == 0x0; i++ {
+	for ; i < len(data) && data[i] == 0x0; i++ {
 		num_zeros++
 	}
 	log.Printf("Number of header zero bytes read: %v\r\n", num_zeros)
 	return true, i
 }
 
-// isRawFooterASCIIHex returns true if this is a correct ASCII Hex transfer data header
-func isRawFooterASCIIHex(data []byte) (bool, int) {
+// isRawFooterASCIIHex returns true if this is a correct ASCII Hex transfer data footer
+func isRawFooterASCIIHex(data []byte, profile *FirmwareProfile) (bool, int) {
 	num_zeros := 0
 	pos := 0
 	var i int
@@ -229,19 +199,22 @@ func isRawFooterASCIIHex(data []byte) (bool, int) {
 		return false, 0
 	}
 	pos = pos - 3
-	for i := pos; i > pos-NUM_FOOTER_ZEROES; i-- {
+	if pos-profile.footerZeroes < 0 {
+		return false, 0
+	}
+	for i := pos; i > pos-profile.footerZeroes; i-- {
 		//fmt.Printf("YYYY %02x\n\r", data[i])
 		if data[i] != 0x0 {
 			return false, 0
 		}
 	}
 	// Overread remaining 0x0
-	for ; data[i] == 0x0; i-- {
+	for i = pos; i >= 0 && data[i] == 0x0; i-- {
 		num_zeros++
 	}
 	log.Printf("ASCII-Hex footer OK\r\n")
-	log.Printf("Number of header zero bytes read: %v\r\n", num_zeros)
-	return true, pos - NUM_FOOTER_ZEROES
+	log.Printf("Number of footer zero bytes read: %v\r\n", num_zeros)
+	return true, pos - profile.footerZeroes
 }
 
 // dumpLine pretty print a line received with address and hex codes
@@ -2,7 +2,6 @@ package main
 
 import (
 	"fmt"
-	"log"
 	"strings"
 )
 
@@ -11,35 +10,40 @@ type GenericData struct {
 	rawData  []byte
 }
 
-var genericState *GenericData = new(GenericData)
-
 func initGenericFormat(ando *AndoConnection) {
-	genericState = new(GenericData)
+	ando.generic = new(GenericData)
 }
 
 func handleGenericInput(ando *AndoConnection, num int, cbuf []byte, line *LineInfo, number *int, errors *int) {
 	for i := 0; i < num; i++ {
 		b := cbuf[i]
-		fmt.Printf("%02x ", b)
-		genericState.rawCount++
-		genericState.rawData = append(genericState.rawData, b)
+		if !ando.quiet {
+			fmt.Printf("%02x ", b)
+		}
+		ando.generic.rawCount++
+		ando.generic.rawData = append(ando.generic.rawData, b)
+	}
+	if ando.progress != nil {
+		ando.progress.done += num
+	}
+	if !ando.quiet {
+		fmt.Printf("\n\r")
 	}
-	fmt.Printf("\n\r")
 }
 
 func parseGeneric(ando *AndoConnection, errors *int) {
-	log.Printf("Parsing GENERIC format\n\r")
-	valid, dataStart := isRawHeader(genericState.rawData)
+	logf(ando, "Parsing GENERIC format\n\r")
+	valid, dataStart := isRawHeader(ando.generic.rawData)
 	if !valid {
-		log.Printf("Not a raw header!\n\r")
+		logf(ando, "Not a raw header!\n\r")
 		*errors++
 	}
-	valid, dataEnd := isRawFooter(genericState.rawData)
+	valid, dataEnd := isRawFooter(ando.generic.rawData)
 	if !valid {
-		log.Printf("Not a raw footer!\n\r")
+		logf(ando, "Not a raw footer!\n\r")
 		*errors++
 	}
-	log.Printf("%v bytes in range %v-%v\n\r", (dataEnd - dataStart), dataStart, dataEnd)
+	logf(ando, "%v bytes in range %v-%v\n\r", (dataEnd - dataStart), dataStart, dataEnd)
 
 	sb := new(strings.Builder)
 	sb.WriteString("\n\r")
@@ -53,7 +57,7 @@ func parseGeneric(ando *AndoConnection, errors *int) {
 			address += 16
 			bytesInLine = 0
 		}
-		b := genericState.rawData[i]
+		b := ando.generic.rawData[i]
 		str := fmt.Sprintf("%02x ", b)
 		sb.WriteString(str)
 
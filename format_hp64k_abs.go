@@ -39,24 +39,24 @@ func initHp64KFormat(ando *AndoConnection) {
 
 // parseHp64KFormat parses all records in data.
 func parseHp64KFormat(ando *AndoConnection, lineNumber *int, errors *int) {
-	log.Printf("Parsing HP64K format\n\r")
+	logf(ando, "Parsing HP64K format\n\r")
 
 	i := 0
 	valid := readSOFRecord(ando, &i, errors)
 	//dumpSOFRecord(ando, ando.hp64k.sof)
 	if !valid {
-		log.Printf("Error reading SOF record\n\r")
+		logf(ando, "Error reading SOF record\n\r")
 		return
 	}
 
-	for i < len(genericState.rawData) {
+	for i < len(ando.generic.rawData) {
 		valid := readRecord(ando, &i, errors)
 		if !valid {
 			if ando.hp64k.data.wordCount == 0 && *errors == 0 {
-				log.Printf("Reading Data complete\n\r")
+				logf(ando, "Reading Data complete\n\r")
 			} else {
 				if *errors > 0 {
-					log.Printf("Error reading Data record\n\r")
+					logf(ando, "Error reading Data record\n\r")
 				}
 			}
 			return
@@ -77,59 +77,59 @@ func parseHp64KFormat(ando *AndoConnection, lineNumber *int, errors *int) {
 
 // readSOFRecord reads Start-Of-File record. Returns true if everything is fine, false on error.
 func readSOFRecord(ando *AndoConnection, i *int, errors *int) bool {
-	b := genericState.rawData[*i]
+	b := ando.generic.rawData[*i]
 	if b != 0x4 {
-		log.Printf("Illegal wordCount byte with value %v in raw data (value should be always 0x4)\n\r", b)
+		logf(ando, "Illegal wordCount byte with value %v in raw data (value should be always 0x4)\n\r", b)
 		*errors++
 		return false
 	}
 	ando.hp64k.sof.wordCount = b
 
 	*i++
-	b = genericState.rawData[*i]
+	b = ando.generic.rawData[*i]
 	ando.hp64k.sof.dataBusWidth = uint16(b) << 8
 	ando.hp64k.sof.checksum += b
 	*i++
-	b = genericState.rawData[*i]
+	b = ando.generic.rawData[*i]
 	ando.hp64k.sof.dataBusWidth += uint16(b)
 	ando.hp64k.sof.checksum += b
 
 	*i++
-	b = genericState.rawData[*i]
+	b = ando.generic.rawData[*i]
 	ando.hp64k.sof.dataWidthBase = uint16(b) << 8
 	ando.hp64k.sof.checksum += b
 	*i++
-	b = genericState.rawData[*i]
+	b = ando.generic.rawData[*i]
 	ando.hp64k.sof.dataWidthBase += uint16(b)
 	ando.hp64k.sof.checksum += b
 
 	// "Transfer address"
 	*i++
-	b = genericState.rawData[*i]
+	b = ando.generic.rawData[*i]
 	ando.hp64k.sof.transferAddress = uint32(b) << 8
 	ando.hp64k.sof.checksum += b
 	*i++
-	b = genericState.rawData[*i]
+	b = ando.generic.rawData[*i]
 	ando.hp64k.sof.transferAddress += uint32(b)
 	ando.hp64k.sof.checksum += b
 	*i++
-	b = genericState.rawData[*i]
+	b = ando.generic.rawData[*i]
 	ando.hp64k.sof.transferAddress += uint32(b) << 24
 	ando.hp64k.sof.checksum += b
 	*i++
-	b = genericState.rawData[*i]
+	b = ando.generic.rawData[*i]
 	ando.hp64k.sof.transferAddress += uint32(b) << 16
 	ando.hp64k.sof.checksum += b
 
 	*i++
-	b = genericState.rawData[*i]
+	b = ando.generic.rawData[*i]
 	if b != ando.hp64k.sof.checksum {
-		log.Printf("sof.checksum mismatch 0x%02x!=0x%02xd!\n\r", b, ando.hp64k.sof.checksum)
+		logf(ando, "sof.checksum mismatch 0x%02x!=0x%02xd!\n\r", b, ando.hp64k.sof.checksum)
 		*errors++
 		return false
 	} else {
 		if ando.debug >= 1 {
-			log.Printf("Start-Of-File record checksum ok!\n\r")
+			logf(ando, "Start-Of-File record checksum ok!\n\r")
 		}
 	}
 	*i++
@@ -153,21 +153,21 @@ func readRecord(ando *AndoConnection, i *int, errors *int) bool {
 	// data bytes in record
 	dataBytesEnd := *i + int(ando.hp64k.data.byteCount)
 	for *i < dataBytesEnd {
-		b = genericState.rawData[*i]
+		b = ando.generic.rawData[*i]
 		ando.hp64k.data.bytes = append(ando.hp64k.data.bytes, b)
 		ando.hp64k.data.checksum += b
 		*i++
 	}
 
 	// checksum
-	b = genericState.rawData[*i]
+	b = ando.generic.rawData[*i]
 	if b != ando.hp64k.data.checksum {
-		log.Printf("data.checksum mismatch read:0x%02x != calculated:0x%02x! pos=%v\n\r", b, ando.hp64k.data.checksum, *i)
+		logf(ando, "data.checksum mismatch read:0x%02x != calculated:0x%02x! pos=%v\n\r", b, ando.hp64k.data.checksum, *i)
 		*errors++
 		return false
 	} else {
 		if ando.debug > 2 {
-			log.Printf("Data record checksum ok!\n\r")
+			logf(ando, "Data record checksum ok!\n\r")
 		}
 	}
 
@@ -180,37 +180,37 @@ func readRecord(ando *AndoConnection, i *int, errors *int) bool {
 // Cursor value i must point on calling to first byte of header. cursor will point to first byte of next record on exit.
 func readRecordHeader(ando *AndoConnection, i *int) bool {
 	// wordCount
-	b := genericState.rawData[*i]
+	b := ando.generic.rawData[*i]
 	ando.hp64k.data.wordCount = b
 	if b == 0x0 {
-		log.Printf("End-Of-File record received\n\r")
+		logf(ando, "End-Of-File record received\n\r")
 		return false
 	}
 	*i++
 	// byteCount
-	b = genericState.rawData[*i]
+	b = ando.generic.rawData[*i]
 	ando.hp64k.data.byteCount = uint16(b) << 8
 	ando.hp64k.data.checksum += b
 	*i++
-	b = genericState.rawData[*i]
+	b = ando.generic.rawData[*i]
 	ando.hp64k.data.byteCount = uint16(b)
 	ando.hp64k.data.checksum += b
 
 	// Target address
 	*i++
-	b = genericState.rawData[*i]
+	b = ando.generic.rawData[*i]
 	ando.hp64k.data.targetAddress = uint32(b) << 8
 	ando.hp64k.data.checksum += b
 	*i++
-	b = genericState.rawData[*i]
+	b = ando.generic.rawData[*i]
 	ando.hp64k.data.targetAddress += uint32(b)
 	ando.hp64k.data.checksum += b
 	*i++
-	b = genericState.rawData[*i]
+	b = ando.generic.rawData[*i]
 	ando.hp64k.data.targetAddress += uint32(b) << 24
 	ando.hp64k.data.checksum += b
 	*i++
-	b = genericState.rawData[*i]
+	b = ando.generic.rawData[*i]
 	ando.hp64k.data.targetAddress += uint32(b) << 16
 	ando.hp64k.data.checksum += b
 
@@ -222,8 +222,8 @@ func readRecordHeader(ando *AndoConnection, i *int) bool {
 // dumpDataRecord dump a Data record
 func dumpDataRecord(ando *AndoConnection, record *DataRecord) {
 	if ando.debug > 1 {
-		log.Printf("\n\rdata.wordCount=%d\n\r", record.wordCount)
-		log.Printf("data.byteCount=%d\n\r", record.byteCount)
+		logf(ando, "\n\rdata.wordCount=%d\n\r", record.wordCount)
+		logf(ando, "data.byteCount=%d\n\r", record.byteCount)
 	}
 	fmt.Printf("0x%08x: ", record.targetAddress)
 	for _, b := range record.bytes {
@@ -231,7 +231,7 @@ func dumpDataRecord(ando *AndoConnection, record *DataRecord) {
 	}
 	fmt.Printf("\n\r")
 	if ando.debug > 1 {
-		log.Printf("data.checksum=0x%02x\n\r", record.checksum)
+		logf(ando, "data.checksum=0x%02x\n\r", record.checksum)
 	}
 }
 
@@ -245,3 +245,42 @@ func dumpSOFRecord(ando *AndoConnection, record *StartOfFileRecord) {
 		fmt.Printf("sof.checksum=0x%02x\n\r", record.checksum)
 	}
 }
+
+// encodeHp64K encodes bytes as HP64000ABS Start-Of-File record, data records with 16 bytes each
+// and End-Of-File record (if firmware understands it), like being uploaded to EPrommer.
+// First byte goes to EPrommer's RAM buffer address offset.
+func encodeHp64K(bytes []byte, offset int, profile *FirmwareProfile) []byte {
+	var checksum uint32 = 0
+	// Start-Of-File record: data bus width 8, data width base 8, transfer address 0
+	data := []byte{0x4, 0x0, 0x8, 0x0, 0x8, 0x0, 0x0, 0x0, 0x0, 0x10}
+
+	for pos := 0; pos < len(bytes); pos += 16 {
+		end := pos + 16
+		if end > len(bytes) {
+			end = len(bytes)
+		}
+		values := bytes[pos:end]
+		address := offset + pos
+		record := []byte{
+			byte((len(values) + 7) / 2),
+			byte(len(values) >> 8), byte(len(values)),
+			byte(address >> 8), byte(address), byte(address >> 24), byte(address >> 16),
+		}
+		record = append(record, values...)
+		var recordChecksum byte
+		for _, b := range record[1:] {
+			recordChecksum += b
+		}
+		data = append(data, record...)
+		data = append(data, recordChecksum)
+		for _, b := range values {
+			checksum += uint32(b)
+		}
+	}
+	if profile.hp64kEndOfFile {
+		// End-Of-File record
+		data = append(data, 0x0)
+	}
+	log.Printf("Upload data checksum: 0x%06x\n\r", checksum)
+	return data
+}
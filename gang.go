@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// In gang mode the same batch job runs on several EPrommers in parallel. Every device gets its own
+// session (AndoConnection) with its own serial connection and protocol state, created from the
+// session built from command line options.
+
+// GangResult result of batch job on one device
+type GangResult struct {
+	device   string
+	exitCode int
+	reply    string  // last result message sent by EPrommer
+	seconds  float64 // duration of job
+	done     bool
+}
+
+// SessionStatus status of a session shown in gang status table
+type SessionStatus struct {
+	state   ConnState
+	romType string
+	reply   string // last result message sent by EPrommer
+	percent int    // progress of transfer running, -1 if there is none or total is not known
+}
+
+// StatusBoard status of a session, published by the goroutines of the session and read by others
+type StatusBoard struct {
+	mutex  sync.Mutex
+	status SessionStatus
+}
+
+// publishStatus publishes current status of session, if session has a status board
+func publishStatus(ando *AndoConnection) {
+	if ando.board == nil {
+		return
+	}
+	status := SessionStatus{state: ando.state, romType: romTypeName(ando), reply: ando.lastReply, percent: -1}
+	if progress := activeProgress(ando); progress != nil {
+		status.percent = progress.percent()
+	}
+	ando.board.mutex.Lock()
+	ando.board.status = status
+	ando.board.mutex.Unlock()
+}
+
+// read returns status published last
+func (board *StatusBoard) read() SessionStatus {
+	board.mutex.Lock()
+	defer board.mutex.Unlock()
+	return board.status
+}
+
+// logf logs like log.Printf, in gang mode the message is prefixed with the device name of the session
+func logf(ando *AndoConnection, format string, v ...interface{}) {
+	if ando.name != "" {
+		text := strings.TrimLeft(format, "\r\n")
+		format = format[:len(format)-len(text)] + "[" + strings.ReplaceAll(ando.name, "%", "%%") + "] " + text
+	}
+	log.Printf(format, v...)
+}
+
+// exitCodeName returns result name of a batch exit code
+func exitCodeName(exitCode int) string {
+	switch exitCode {
+	case ExitOK:
+		return "PASS"
+	case ExitFailed:
+		return "FAIL"
+	case ExitError:
+		return "ERROR"
+	case ExitUnknown:
+		return "UNKNOWN JOB"
+	}
+	return "unknown"
+}
+
+// gangFileName returns output file name for a device, e.g. "out" -> "out-ttyUSB0"
+func gangFileName(filename string, name string) string {
+	return filename + "-" + name
+}
+
+// newGangSession creates session for device from template session
+func newGangSession(template *AndoConnection, device string) (*AndoConnection, error) {
+	serial := *template.serial
+	serial.device = device
+	session := *template
+	session.serial = &serial
+	session.name = filepath.Base(device)
+	session.generic = new(GenericData)
+	session.progress = nil
+	session.quiet = true
+	session.state = NormalInput
+	session.continueLoop = newContinueLoop()
+	session.sessionLock = &sync.Mutex{}
+	session.consoleLock = &sync.Mutex{}
+	session.board = &StatusBoard{status: SessionStatus{state: NormalInput, romType: "unknown", percent: -1}}
+	session.downloadFile = gangFileName(template.downloadFile, session.name)
+	if !session.dryMode {
+		err := session.serial.openTTY()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &session, nil
+}
+
+// runGang runs batch job on all devices in parallel. Shows a status table while jobs are running and a
+// combined report at the end. Returns ExitOK if job passed on all devices, otherwise the worst exit code.
+func runGang(template *AndoConnection, devices []string, args []string) int {
+	sessions := make([]*AndoConnection, len(devices))
+	results := make([]GangResult, len(devices))
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for i, device := range devices {
+		results[i].device = device
+		session, err := newGangSession(template, device)
+		if err != nil {
+			log.Printf("Error opening %v: %s\n\r", device, err)
+			results[i].exitCode = ExitError
+			results[i].done = true
+			continue
+		}
+		sessions[i] = session
+		go ttyReader(session)
+		wg.Add(1)
+		go func(i int, session *AndoConnection) {
+			defer wg.Done()
+			start := time.Now()
+			exitCode := runBatch(session, args)
+			publishStatus(session)
+			stopRunning(session)
+			if !session.dryMode {
+				session.serial.tty.Close()
+			}
+			mutex.Lock()
+			results[i].exitCode = exitCode
+			results[i].reply = session.lastReply
+			results[i].seconds = time.Since(start).Seconds()
+			results[i].done = true
+			mutex.Unlock()
+		}(i, session)
+	}
+
+	finished := make(chan bool)
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+	table := ""
+	for {
+		mutex.Lock()
+		status := gangStatusTable(sessions, results)
+		mutex.Unlock()
+		if status != table {
+			table = status
+			fmt.Print(table)
+		}
+		select {
+		case <-finished:
+			return printGangReport(results)
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// gangStatusTable returns table with state of all devices
+func gangStatusTable(sessions []*AndoConnection, results []GangResult) string {
+	sb := new(strings.Builder)
+	fmt.Fprintf(sb, "\n\r%-20v %-15v %-10v %v\n\r", "Device", "State", "ROM type", "Last reply")
+	for i, result := range results {
+		state := "running"
+		romType := ""
+		reply := ""
+		if sessions[i] != nil {
+			status := sessions[i].board.read()
+			state = status.state.String()
+			if status.percent >= 0 {
+				state = fmt.Sprintf("%v %v%%", state, status.percent)
+			}
+			romType = status.romType
+			reply = status.reply
+		}
+		if result.done {
+			state = exitCodeName(result.exitCode)
+		}
+		fmt.Fprintf(sb, "%-20v %-15v %-10v %v\n\r", result.device, state, romType, reply)
+	}
+	return sb.String()
+}
+
+// printGangReport prints combined report of all devices and returns combined exit code
+func printGangReport(results []GangResult) int {
+	exitCode := ExitOK
+	passed := 0
+	fmt.Printf("\n\r%-20v %-8v %-9v %v\n\r", "Device", "Result", "Duration", "Last reply")
+	for _, result := range results {
+		fmt.Printf("%-20v %-8v %-9v %v\n\r", result.device, exitCodeName(result.exitCode),
+			fmt.Sprintf("%.1fs", result.seconds), result.reply)
+		if result.exitCode == ExitOK {
+			passed++
+		}
+		if result.exitCode > exitCode {
+			exitCode = result.exitCode
+		}
+	}
+	log.Printf("Gang report: %v devices, %v passed, %v failed\n\r", len(results), passed, len(results)-passed)
+	return exitCode
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogf(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	log.SetFlags(0)
+	defer func() {
+		log.SetOutput(os.Stderr)
+		log.SetFlags(log.LstdFlags)
+	}()
+	tests := []struct {
+		name   string
+		format string
+		line   string
+	}{
+		{"", "PASS %v\n\r", "PASS 1\n\r\n"},
+		{"ttyUSB0", "PASS %v\n\r", "[ttyUSB0] PASS 1\n\r\n"},
+		{"ttyUSB1", "\n\rEPrommer reported failure: [%v]\n\r", "\n\r[ttyUSB1] EPrommer reported failure: [1]\n\r\n"},
+		{"100%", "%v", "[100%] 1\n"},
+	}
+	for _, test := range tests {
+		buf.Reset()
+		logf(&AndoConnection{name: test.name}, test.format, 1)
+		if buf.String() != test.line {
+			t.Errorf("logf(%v, %q) logged %q, want %q", test.name, test.format, buf.String(), test.line)
+		}
+	}
+}
+
+func TestGangStatusTable(t *testing.T) {
+	session := &AndoConnection{name: "ttyUSB0", board: &StatusBoard{}, lastReply: "PASS", state: ReceiveData,
+		progress: &Progress{done: 50, total: 200}}
+	publishStatus(session)
+	// changes after publishing are not shown until published
+	session.lastReply = "FAIL"
+	results := []GangResult{{device: "/dev/ttyUSB0"}, {device: "/dev/ttyUSB1", exitCode: ExitError, done: true}}
+	table := gangStatusTable([]*AndoConnection{session, nil}, results)
+	if !strings.Contains(table, "downloading 25%") || !strings.Contains(table, "PASS") || strings.Contains(table, "FAIL") {
+		t.Errorf("status table of running device:\n%v", table)
+	}
+	if !strings.Contains(table, "/dev/ttyUSB1") || !strings.Contains(table, "ERROR") {
+		t.Errorf("status table of failed device:\n%v", table)
+	}
+}
+
+func TestExitCodeName(t *testing.T) {
+	names := map[int]string{ExitOK: "PASS", ExitFailed: "FAIL", ExitError: "ERROR", ExitUnknown: "UNKNOWN JOB", 42: "unknown"}
+	for exitCode, name := range names {
+		if exitCodeName(exitCode) != name {
+			t.Errorf("exitCodeName(%v) = %v, want %v", exitCode, exitCodeName(exitCode), name)
+		}
+	}
+}
+
+func TestRunGangDryMode(t *testing.T) {
+	template := &AndoConnection{dryMode: true, lanes: 1, rangeLength: -1, serial: &AndoSerialConnection{}}
+	exitCode := runGang(template, []string{"/dev/ttyUSB0", "/dev/ttyUSB1"}, []string{"romtypes"})
+	if exitCode != ExitOK {
+		t.Errorf("gang gave exit code %v", exitCode)
+	}
+	if exitCode := runGang(template, []string{"/dev/ttyUSB0"}, []string{"no-such-job"}); exitCode != ExitUnknown {
+		t.Errorf("gang with unknown job gave exit code %v", exitCode)
+	}
+	// EPrommer never answers in dry mode, download must not wait for timeout
+	template.serial.timeout = 300 * time.Second
+	template.downloadFile = filepath.Join(t.TempDir(), "out")
+	start := time.Now()
+	if exitCode := runGang(template, []string{"/dev/ttyUSB0"}, []string{"download"}); exitCode != ExitError {
+		t.Errorf("gang dry mode download gave exit code %v", exitCode)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("gang dry mode download took %v", elapsed)
+	}
+}
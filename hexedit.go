@@ -0,0 +1,390 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// ByteEdit an edit of a byte, kept for undo
+type ByteEdit struct {
+	address int
+	old     byte
+}
+
+// HexEditor state of full-screen hex/ASCII viewer and editor for data downloaded last
+type HexEditor struct {
+	image     []byte     // in-memory image, i.e. all bytes of ando.lineInfos
+	cursor    int        // address of byte under cursor
+	top       int        // first line shown
+	rows      int        // number of data lines on screen
+	nibble    int        // 0: next hex digit typed is high nibble, 1: low nibble
+	asciiMode bool       // typed chars go to ASCII column instead of hex column
+	undo      []ByteEdit // edits, last edit at end
+	search    []byte     // last search pattern
+	message   string     // message shown in status line
+}
+
+const hexEditorHelp = "arrows/PgUp/PgDn/Home/End move  Tab hex/ASCII  ^G goto  ^F search  ^N next  ^Z undo  ^X quit" +
+	"  (hex column: g / n u q)"
+
+// runHexEditor runs full-screen hex editor on data downloaded last, until user quits it.
+// Edited bytes are written back into ando.lineInfos and marked in ando.edits, so that the image
+// can be saved with ': w' or uploaded with ': u'.
+func runHexEditor(ando *AndoConnection, consoleReader *bufio.Reader) {
+	if len(ando.lineInfos) == 0 {
+		logf(ando, "No data downloaded yet, nothing to edit\n\r")
+		return
+	}
+	if ando.edits == nil {
+		ando.edits = make(map[int]byte)
+	}
+	editor := HexEditor{image: imageFromLineInfos(ando.lineInfos)}
+	previousState := ando.state
+	ando.state = Editing
+	defer func() {
+		ando.state = previousState
+		fmt.Fprint(terminalOutput, "\x1b[2J\x1b[H")
+		updateEditedChecksums(ando)
+	}()
+
+	for {
+		editor.draw(ando)
+		b, err := consoleReader.ReadByte()
+		if err != nil {
+			return
+		}
+		if !editor.handleKey(ando, consoleReader, b) {
+			return
+		}
+	}
+}
+
+// handleKey handles a key typed in hex editor. Returns false if editor is to be quit.
+func (editor *HexEditor) handleKey(ando *AndoConnection, consoleReader *bufio.Reader, b byte) bool {
+	editor.message = ""
+	switch b {
+	case 0x1b:
+		if consoleReader.Buffered() == 0 {
+			// plain ESC
+			return false
+		}
+		editor.handleEscapeSequence(consoleReader)
+		return true
+	case 0x18, 0x3:
+		// Ctrl-X, Ctrl-C
+		return false
+	case '\t':
+		editor.asciiMode = !editor.asciiMode
+		editor.nibble = 0
+		return true
+	case 0x7:
+		editor.gotoPrompt(consoleReader)
+		return true
+	case 0x6:
+		editor.searchPrompt(consoleReader)
+		return true
+	case 0xe:
+		editor.searchNext()
+		return true
+	case 0x1a:
+		editor.undoEdit(ando)
+		return true
+	}
+	if editor.asciiMode {
+		if b >= 0x20 && b < 0x7f {
+			editor.setByte(ando, b)
+			editor.move(1)
+		}
+		return true
+	}
+	switch b {
+	case 'q':
+		return false
+	case 'g':
+		editor.gotoPrompt(consoleReader)
+	case '/':
+		editor.searchPrompt(consoleReader)
+	case 'n':
+		editor.searchNext()
+	case 'u':
+		editor.undoEdit(ando)
+	default:
+		value, err := hex.DecodeString("0" + string(b))
+		if err != nil {
+			return true
+		}
+		old := editor.image[editor.cursor]
+		if editor.nibble == 0 {
+			editor.setByte(ando, value[0]<<4|old&0x0f)
+			editor.nibble = 1
+		} else {
+			editor.setByte(ando, old&0xf0|value[0])
+			editor.nibble = 0
+			editor.move(1)
+		}
+	}
+	return true
+}
+
+// handleEscapeSequence handles cursor keys
+func (editor *HexEditor) handleEscapeSequence(consoleReader *bufio.Reader) {
+	switch readCursorKey(consoleReader) {
+	case 'A':
+		editor.move(-16)
+	case 'B':
+		editor.move(16)
+	case 'C':
+		editor.move(1)
+	case 'D':
+		editor.move(-1)
+	case 'H':
+		editor.cursor = 0
+	case 'F':
+		editor.cursor = len(editor.image) - 1
+	case '5':
+		editor.move(-16 * editor.rows)
+	case '6':
+		editor.move(16 * editor.rows)
+	}
+	editor.nibble = 0
+}
+
+// readCursorKey reads rest of an escape sequence after ESC. Returns 'A' (up), 'B' (down), 'C' (right),
+// 'D' (left), 'H' (Home), 'F' (End), '3' (Delete), '5' (PgUp), '6' (PgDn) or 0 for any other sequence.
+func readCursorKey(consoleReader *bufio.Reader) byte {
+	b, _ := consoleReader.ReadByte()
+	if b != '[' && b != 'O' {
+		return 0
+	}
+	b, _ = consoleReader.ReadByte()
+	switch b {
+	case 'A', 'B', 'C', 'D', 'H', 'F':
+		return b
+	}
+	// sequences like ESC [ 5 ~ or ESC [ 1 ; 5 C, read up to final char
+	key := b
+	for (b >= '0' && b <= '9') || b == ';' {
+		b, _ = consoleReader.ReadByte()
+	}
+	if b != '~' {
+		return 0
+	}
+	switch key {
+	case '1', '7':
+		return 'H'
+	case '4', '8':
+		return 'F'
+	case '3', '5', '6':
+		return key
+	}
+	return 0
+}
+
+// move moves cursor by delta bytes, cursor stays within image
+func (editor *HexEditor) move(delta int) {
+	editor.cursor += delta
+	if editor.cursor < 0 {
+		editor.cursor = 0
+	}
+	if editor.cursor >= len(editor.image) {
+		editor.cursor = len(editor.image) - 1
+	}
+}
+
+// setByte changes byte under cursor, the change is recorded for undo and marked as edit
+func (editor *HexEditor) setByte(ando *AndoConnection, value byte) {
+	address := editor.cursor
+	old := editor.image[address]
+	if old == value {
+		return
+	}
+	editor.undo = append(editor.undo, ByteEdit{address, old})
+	if _, found := ando.edits[address]; !found {
+		ando.edits[address] = old
+	}
+	editor.writeByte(ando, address, value)
+}
+
+// writeByte writes byte into image and ando.lineInfos. Edit marks are removed if original value is back.
+func (editor *HexEditor) writeByte(ando *AndoConnection, address int, value byte) {
+	editor.image[address] = value
+	ando.lineInfos[address/16].codes[address%16] = value
+	if original, found := ando.edits[address]; found && original == value {
+		delete(ando.edits, address)
+	}
+}
+
+// undoEdit reverts last edit
+func (editor *HexEditor) undoEdit(ando *AndoConnection) {
+	if len(editor.undo) == 0 {
+		editor.message = "Nothing to undo"
+		return
+	}
+	edit := editor.undo[len(editor.undo)-1]
+	editor.undo = editor.undo[:len(editor.undo)-1]
+	editor.writeByte(ando, edit.address, edit.old)
+	editor.cursor = edit.address
+	editor.nibble = 0
+}
+
+// gotoPrompt asks for an address and moves cursor there
+func (editor *HexEditor) gotoPrompt(consoleReader *bufio.Reader) {
+	text := editor.prompt(consoleReader, "Goto address (0x.. or decimal): ")
+	if text == "" {
+		return
+	}
+	if !strings.HasPrefix(text, "0x") && strings.ContainsAny(text, "abcdefABCDEF") {
+		text = "0x" + text
+	}
+	address, err := parseNumber(text, 0)
+	if err != nil || address >= len(editor.image) {
+		editor.message = fmt.Sprintf("Illegal address %v", text)
+		return
+	}
+	editor.cursor = address
+	editor.nibble = 0
+}
+
+// searchPrompt asks for a search pattern and searches it from cursor.
+// Pattern is a byte sequence ("de ad be ef") or a string ("\"text\"" or anything that is no hex).
+func (editor *HexEditor) searchPrompt(consoleReader *bufio.Reader) {
+	text := editor.prompt(consoleReader, "Search (hex bytes or \"text\"): ")
+	if text == "" {
+		return
+	}
+	editor.search = parseSearchPattern(text)
+	editor.searchNext()
+}
+
+// searchNext searches last pattern after cursor, search wraps at end of image
+func (editor *HexEditor) searchNext() {
+	if len(editor.search) == 0 {
+		editor.message = "No search pattern"
+		return
+	}
+	address := searchBytes(editor.image, editor.search, editor.cursor+1)
+	if address < 0 {
+		editor.message = "Pattern not found"
+		return
+	}
+	editor.cursor = address
+	editor.nibble = 0
+	editor.message = fmt.Sprintf("Found at 0x%08x", address)
+}
+
+// parseSearchPattern converts search text into bytes to search for
+func parseSearchPattern(text string) []byte {
+	if strings.HasPrefix(text, "\"") {
+		return []byte(strings.Trim(text, "\""))
+	}
+	pattern, err := hex.DecodeString(strings.ReplaceAll(text, " ", ""))
+	if err != nil {
+		return []byte(text)
+	}
+	return pattern
+}
+
+// searchBytes returns address of first occurrence of pattern at or after from, wrapping around
+// at end of image. Returns -1 if pattern is not found.
+func searchBytes(image []byte, pattern []byte, from int) int {
+	if from >= len(image) {
+		from = 0
+	}
+	pos := bytes.Index(image[from:], pattern)
+	if pos >= 0 {
+		return from + pos
+	}
+	return bytes.Index(image, pattern)
+}
+
+// prompt reads a line of input in status line of editor
+func (editor *HexEditor) prompt(consoleReader *bufio.Reader, text string) string {
+	fmt.Fprintf(terminalOutput, "\x1b[%d;1H\x1b[K", editor.rows+3)
+	return readInputLine(consoleReader, text)
+}
+
+// draw draws editor screen: status line, data lines with hex and ASCII columns, help line
+func (editor *HexEditor) draw(ando *AndoConnection) {
+	_, height, err := term.GetSize(int(os.Stdin.Fd()))
+	if err != nil || height < 6 {
+		height = 24
+	}
+	editor.rows = height - 4
+	line := editor.cursor / 16
+	if line < editor.top {
+		editor.top = line
+	}
+	if line >= editor.top+editor.rows {
+		editor.top = line - editor.rows + 1
+	}
+
+	sb := new(strings.Builder)
+	sb.WriteString("\x1b[2J\x1b[H")
+	column := "hex"
+	if editor.asciiMode {
+		column = "ASCII"
+	}
+	fmt.Fprintf(sb, "\x1b[7m Hex editor  0x%08x = %02x  size 0x%x  %v edited bytes  editing %v column \x1b[0m\r\n",
+		editor.cursor, editor.image[editor.cursor], len(editor.image), len(ando.edits), column)
+	for row := 0; row < editor.rows; row++ {
+		start := (editor.top + row) * 16
+		if start >= len(editor.image) {
+			sb.WriteString("\r\n")
+			continue
+		}
+		fmt.Fprintf(sb, "%08x  ", start)
+		ascii := new(strings.Builder)
+		for address := start; address < start+16; address++ {
+			if address >= len(editor.image) {
+				sb.WriteString("   ")
+				continue
+			}
+			b := editor.image[address]
+			c := byte('.')
+			if b >= 0x20 && b < 0x7f {
+				c = b
+			}
+			style := editor.byteStyle(ando, address)
+			fmt.Fprintf(sb, "%v%02x\x1b[0m ", style, b)
+			fmt.Fprintf(ascii, "%v%c\x1b[0m", style, c)
+			if address%16 == 7 {
+				sb.WriteString(" ")
+			}
+		}
+		fmt.Fprintf(sb, " |%v|\r\n", ascii.String())
+	}
+	fmt.Fprintf(sb, "%v\r\n", editor.message)
+	fmt.Fprintf(sb, "\x1b[2m%v\x1b[0m", hexEditorHelp)
+	fmt.Fprint(terminalOutput, sb.String())
+}
+
+// byteStyle returns ANSI style for byte: cursor is shown reverse, edited bytes bold red
+func (editor *HexEditor) byteStyle(ando *AndoConnection, address int) string {
+	style := ""
+	if _, edited := ando.edits[address]; edited {
+		style += "\x1b[1;31m"
+	}
+	if address == editor.cursor {
+		style += "\x1b[7m"
+	}
+	return style
+}
+
+// updateEditedChecksums recalculates checksums after editing
+func updateEditedChecksums(ando *AndoConnection) {
+	image := imageFromLineInfos(ando.lineInfos)
+	ando.checksum = 0
+	for _, b := range image {
+		ando.checksum += uint32(b)
+	}
+	ando.checksums = computeChecksums(downloadedImage(ando), ando.sumStart, ando.sumLength)
+	if len(ando.edits) > 0 {
+		logf(ando, "%v bytes edited, checksum is now %06x. Save with ': w' or upload with ': u'\n\r", len(ando.edits), ando.checksum)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParseSearchPattern(t *testing.T) {
+	tests := []struct {
+		text    string
+		pattern []byte
+	}{
+		{"4e75", []byte{0x4e, 0x75}},
+		{"4E 71 4e 75", []byte{0x4e, 0x71, 0x4e, 0x75}},
+		{"\"PROMAC\"", []byte("PROMAC")},
+		{"V21.9", []byte("V21.9")},
+		{"abc", []byte("abc")},
+	}
+	for _, test := range tests {
+		if pattern := parseSearchPattern(test.text); !bytes.Equal(pattern, test.pattern) {
+			t.Errorf("parseSearchPattern(%q) = % x, want % x", test.text, pattern, test.pattern)
+		}
+	}
+}
+
+func TestSearchBytes(t *testing.T) {
+	image := []byte{1, 2, 3, 1, 2, 3, 4}
+	tests := []struct {
+		pattern []byte
+		from    int
+		address int
+	}{
+		{[]byte{1, 2}, 0, 0},
+		{[]byte{1, 2}, 1, 3},
+		{[]byte{1, 2}, 4, 0},
+		{[]byte{3, 4}, 0, 5},
+		{[]byte{5}, 0, -1},
+		{[]byte{1}, 100, 0},
+	}
+	for _, test := range tests {
+		if address := searchBytes(image, test.pattern, test.from); address != test.address {
+			t.Errorf("searchBytes(% x, %v) = %v, want %v", test.pattern, test.from, address, test.address)
+		}
+	}
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// imageFromLineInfos converts lines received from EPrommer into a flat byte image
+func imageFromLineInfos(lineInfos []LineInfo) []byte {
+	var image []byte
+	for _, line := range lineInfos {
+		image = append(image, line.codes[:]...)
+	}
+	return image
+}
+
+// sliceRange returns range [start, start+length) of data, length -1 means up to end of data.
+// Range is clipped to data size.
+func sliceRange(data []byte, start int, length int) []byte {
+	if start > len(data) {
+		start = len(data)
+	}
+	end := len(data)
+	if length >= 0 && start+length < end {
+		end = start + length
+	}
+	return data[start:end]
+}
+
+// downloadedImage returns range --start/--length of data downloaded last
+func downloadedImage(ando *AndoConnection) []byte {
+	return sliceRange(imageFromLineInfos(ando.lineInfos), ando.rangeStart, ando.rangeLength)
+}
+
+// parseNumber parses a decimal or 0x-prefixed hex number, empty string gives defaultValue
+func parseNumber(text string, defaultValue int) (int, error) {
+	if text == "" {
+		return defaultValue, nil
+	}
+	value, err := strconv.ParseUint(text, 0, 32)
+	if err != nil {
+		return 0, fmt.Errorf("illegal number '%v'", text)
+	}
+	return int(value), nil
+}
+
+// textImageExtensions file name extensions of text images (ASCII-Hex or hex dump)
+var textImageExtensions = []string{".hex", ".txt", ".dump"}
+
+// loadImage loads an EPROM image from local filesystem. The decoder is picked by file name extension:
+// HP64000ABS for *.abs, ASCII-Hex as sent by the EPrommer or hex dumps as written by dumpLine or
+// 'hexdump -C' for *.hex, *.txt and *.dump. Any other file is a plain binary file.
+func loadImage(filename string) ([]byte, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	ext := strings.ToLower(filepath.Ext(filename))
+	if ext == ".abs" {
+		return decodeHp64KImage(data)
+	}
+	if !slices.Contains(textImageExtensions, ext) {
+		return data, nil
+	}
+	if !isText(data) {
+		return nil, fmt.Errorf("%v is not a text file", filepath.Base(filename))
+	}
+	text := strings.TrimLeft(string(data), "\x00\r\n \t")
+	if strings.HasPrefix(text, "[") || strings.HasPrefix(text, "#") {
+		return decodeASCIIHexImage(text)
+	}
+	image, ok := decodeHexDumpImage(text)
+	if !ok {
+		return nil, fmt.Errorf("no ASCII-Hex records or hex dump lines found")
+	}
+	return image, nil
+}
+
+// isText returns true if data contains printable characters and line endings only (0x0 is allowed
+// because ASCII-Hex captures are framed by zeroes)
+func isText(data []byte) bool {
+	if len(data) == 0 {
+		return false
+	}
+	for _, b := range data {
+		if b == 0x0 || b == '\r' || b == '\n' || b == '\t' || b == 0x1a {
+			continue
+		}
+		if b < 0x20 || b > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// placeBytes writes values to image at address, gaps are filled with 0xff (erased EPROM)
+func placeBytes(image []byte, address uint32, values []byte) []byte {
+	end := int(address) + len(values)
+	for len(image) < end {
+		image = append(image, 0xff)
+	}
+	copy(image[address:], values)
+	return image
+}
+
+// decodeASCIIHexImage decodes ASCII-Hex records ('#AAAAAAAA,DD,DD,...,') into an image
+func decodeASCIIHexImage(text string) ([]byte, error) {
+	var image []byte
+	records := strings.FieldsFunc(text, func(r rune) bool {
+		return r == '\r' || r == '\n' || r == '[' || r == ']' || r == 0x0 || r == 0x1a
+	})
+	for _, record := range records {
+		record = strings.TrimSpace(record)
+		if !strings.HasPrefix(record, "#") {
+			continue
+		}
+		fields := strings.Split(record[1:], ",")
+		address, err := strconv.ParseUint(fields[0], 16, 32)
+		if err != nil {
+			return nil, fmt.Errorf("illegal address in record '%v'", record)
+		}
+		var values []byte
+		for _, field := range fields[1:] {
+			if field == "" {
+				continue
+			}
+			value, err := strconv.ParseUint(field, 16, 8)
+			if err != nil {
+				return nil, fmt.Errorf("illegal value %v in record '%v'", field, record)
+			}
+			values = append(values, byte(value))
+		}
+		image = placeBytes(image, uint32(address), values)
+	}
+	if image == nil {
+		return nil, fmt.Errorf("no ASCII-Hex records found")
+	}
+	return image, nil
+}
+
+// decodeHexDumpImage decodes text hex dumps. Supported are lines written by dumpLine
+// ('LLLLLL AAAAAAAA DD DD ...') and by 'hexdump -C' ('AAAAAAAA  DD DD ...  |...|', '*' repeats
+// previous line). Lines not looking like a dump line (e.g. log messages) are ignored.
+func decodeHexDumpImage(text string) ([]byte, bool) {
+	var image []byte
+	var previous []byte
+	repeat := false
+	found := false
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r", "\n"), "\n") {
+		if pos := strings.Index(line, "|"); pos != -1 {
+			line = line[:pos]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 1 && fields[0] == "*" {
+			repeat = true
+			continue
+		}
+		if len(fields) >= 2 && len(fields[0]) == 6 && len(fields[1]) == 8 {
+			// dumpLine format, first field is line number
+			fields = fields[1:]
+		}
+		if len(fields) == 0 || len(fields[0]) != 8 {
+			continue
+		}
+		address, err := strconv.ParseUint(fields[0], 16, 32)
+		if err != nil {
+			continue
+		}
+		var values []byte
+		for _, field := range fields[1:] {
+			value, err := strconv.ParseUint(field, 16, 8)
+			if err != nil || len(field) != 2 {
+				values = nil
+				break
+			}
+			values = append(values, byte(value))
+		}
+		if repeat && previous != nil {
+			// fill up with repeated line until current address
+			for uint32(len(image)) < uint32(address) {
+				image = append(image, previous...)
+			}
+			image = image[:address]
+			repeat = false
+		}
+		if values == nil {
+			// end address line of 'hexdump -C'
+			continue
+		}
+		found = true
+		image = placeBytes(image, uint32(address), values)
+		previous = values
+	}
+	return image, found
+}
+
+// decodeHp64KImage decodes a HP64000ABS file into an image. See file-formats.md for format details.
+func decodeHp64KImage(data []byte) ([]byte, error) {
+	if len(data) < 10 || data[0] != 0x4 {
+		return nil, fmt.Errorf("no HP64000ABS Start-Of-File record found")
+	}
+	var image []byte
+	i := 10
+	for i < len(data) && data[i] != 0x0 {
+		if i+7 > len(data) {
+			return nil, fmt.Errorf("truncated HP64000ABS record at position %v", i)
+		}
+		byteCount := int(data[i+1])<<8 | int(data[i+2])
+		address := uint32(data[i+3])<<8 | uint32(data[i+4]) | uint32(data[i+5])<<24 | uint32(data[i+6])<<16
+		start := i + 7
+		end := start + byteCount
+		if end >= len(data) {
+			return nil, fmt.Errorf("truncated HP64000ABS record at position %v", i)
+		}
+		var checksum byte
+		for _, b := range data[i+1 : end] {
+			checksum += b
+		}
+		if checksum != data[end] {
+			return nil, fmt.Errorf("HP64000ABS record checksum mismatch at position %v", i)
+		}
+		image = placeBytes(image, address, data[start:end])
+		i = end + 1
+	}
+	if image == nil {
+		return nil, fmt.Errorf("no HP64000ABS data records found")
+	}
+	return image, nil
+}
+
+// padImage extends image with fill bytes up to size
+func padImage(image []byte, size int, fill byte) []byte {
+	for len(image) < size {
+		image = append(image, fill)
+	}
+	return image
+}
+
+// trimImage removes trailing fill bytes of image
+func trimImage(image []byte, fill byte) []byte {
+	end := len(image)
+	for end > 0 && image[end-1] == fill {
+		end--
+	}
+	return image[:end]
+}
+
+// roundImage extends image with fill bytes up to next multiple of boundary (e.g. record size 16)
+func roundImage(image []byte, boundary int, fill byte) []byte {
+	if boundary <= 1 || len(image)%boundary == 0 {
+		return image
+	}
+	return padImage(image, (len(image)/boundary+1)*boundary, fill)
+}
+
+// prepareUploadImage selects lane and range of image loaded from file and applies image operations
+// (trim, round to record boundary, pad to ROM size). ROM type must be known for padding.
+func prepareUploadImage(ando *AndoConnection, image []byte) []byte {
+	image = selectLane(ando, image)
+	image = sliceRange(image, ando.rangeStart, ando.rangeLength)
+	if ando.rangeStart != 0 || ando.rangeLength != -1 || ando.offset != 0 {
+		logf(ando, "Using %v bytes from file address 0x%x for buffer address 0x%x\n\r", len(image), ando.rangeStart, ando.offset)
+	}
+	if ando.trim {
+		size := len(image)
+		image = trimImage(image, ando.fill)
+		logf(ando, "Trimmed %v trailing 0x%02x bytes\n\r", size-len(image), ando.fill)
+	}
+	if ando.round {
+		image = roundImage(image, 16, ando.fill)
+	}
+	if ando.pad {
+		if ando.romType == nil {
+			logf(ando, "Warning: ROM type is unknown, image can't be padded (select it with --rom-type)\n\r")
+		} else if ando.offset+len(image) < ando.romType.size {
+			logf(ando, "Padding image with 0x%02x up to end of %v\n\r", ando.fill, ando.romType.name)
+			image = padImage(image, ando.romType.size-ando.offset, ando.fill)
+		}
+	}
+	return image
+}
+
+// checkUploadCoverage warns if upload does not cover the full part, so that leftover
+// RAM buffer contents would be programmed. If ROM type is unknown, coverage can't be checked.
+func checkUploadCoverage(ando *AndoConnection, offset int, size int) {
+	if ando.romType == nil {
+		logf(ando, "Warning: ROM type is unknown, can't check that upload covers the full part "+
+			"(select it with --rom-type)\n\r")
+		return
+	}
+	if offset > 0 || offset+size < ando.romType.size {
+		logf(ando, "Warning: upload covers buffer 0x%x-0x%x only, %v has 0x%x bytes. "+
+			"Rest of RAM buffer keeps its previous contents (use --pad to fill)\n\r",
+			offset, offset+size, ando.romType.name, ando.romType.size)
+	}
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testImage returns an image of size bytes with a counting pattern
+func testImage(size int) []byte {
+	image := make([]byte, size)
+	for i := range image {
+		image[i] = byte(i*7 + 3)
+	}
+	return image
+}
+
+func TestASCIIHexRoundTrip(t *testing.T) {
+	for _, size := range []int{1, 15, 16, 17, 256, 1000} {
+		for _, profile := range firmwareProfiles {
+			image := testImage(size)
+			decoded, err := decodeASCIIHexImage(string(encodeASCIIHex(image, 0, &profile)))
+			if err != nil {
+				t.Fatalf("%v bytes, firmware %v: %v", size, profile.name, err)
+			}
+			if !bytes.Equal(decoded, image) {
+				t.Errorf("%v bytes, firmware %v: decoded image differs", size, profile.name)
+			}
+		}
+	}
+}
+
+func TestDecodeASCIIHexImage(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		image []byte
+		ok    bool
+	}{
+		{"download capture", "\r\n\r\n\x00\x00[#00000000,01,02,\r\n#00000002,03,\r\n]\x00\r\n", []byte{1, 2, 3}, true},
+		{"gap filled with 0xff", "[#00000000,01,\r#00000003,04,\r", []byte{1, 0xff, 0xff, 4}, true},
+		{"illegal address", "[#0000XX00,01,\r", nil, false},
+		{"illegal value", "[#00000000,1FF,\r", nil, false},
+		{"no records", "[]", nil, false},
+	}
+	for _, test := range tests {
+		image, err := decodeASCIIHexImage(test.text)
+		if (err == nil) != test.ok {
+			t.Errorf("%v: error %v", test.name, err)
+			continue
+		}
+		if !bytes.Equal(image, test.image) {
+			t.Errorf("%v: image % x, want % x", test.name, image, test.image)
+		}
+	}
+}
+
+func TestHp64KRoundTrip(t *testing.T) {
+	for _, size := range []int{1, 16, 17, 300} {
+		for _, profile := range firmwareProfiles {
+			image := testImage(size)
+			decoded, err := decodeHp64KImage(encodeHp64K(image, 0, &profile))
+			if err != nil {
+				t.Fatalf("%v bytes, firmware %v: %v", size, profile.name, err)
+			}
+			if !bytes.Equal(decoded, image) {
+				t.Errorf("%v bytes, firmware %v: decoded image differs", size, profile.name)
+			}
+		}
+	}
+}
+
+func TestDecodeHp64KImageErrors(t *testing.T) {
+	data := encodeHp64K(testImage(32), 0, &firmwareProfiles[0])
+	broken := append([]byte(nil), data...)
+	broken[20]++
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"no Start-Of-File record", []byte("not an abs file")},
+		{"truncated", data[:len(data)-5]},
+		{"checksum mismatch", broken},
+		{"no data records", data[:10]},
+	}
+	for _, test := range tests {
+		if _, err := decodeHp64KImage(test.data); err == nil {
+			t.Errorf("%v: no error", test.name)
+		}
+	}
+}
+
+func TestDecodeHexDumpImage(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		image []byte
+		found bool
+	}{
+		{"dumpLine", "000000 00000000 01 02 03\n000001 00000003 04\n", []byte{1, 2, 3, 4}, true},
+		{"hexdump -C", "00000000  01 02  |..|\n00000002  03 04  |..|\n00000004\n", []byte{1, 2, 3, 4}, true},
+		{"hexdump -C repeat", "00000000  01 02\n*\n00000006  03\n00000007\n", []byte{1, 2, 1, 2, 1, 2, 3}, true},
+		{"log messages ignored", "Downloading\n00000000  aa\nDone\n", []byte{0xaa}, true},
+		{"no dump lines", "hello world\n", nil, false},
+	}
+	for _, test := range tests {
+		image, found := decodeHexDumpImage(test.text)
+		if found != test.found || !bytes.Equal(image, test.image) {
+			t.Errorf("%v: image % x found %v, want % x %v", test.name, image, found, test.image, test.found)
+		}
+	}
+}
+
+func TestIsText(t *testing.T) {
+	tests := []struct {
+		data []byte
+		text bool
+	}{
+		{[]byte("#00000000,01,\r\n"), true},
+		{[]byte{0x0, 0x0, '[', ']', 0x1a}, true},
+		{[]byte{0x1, 0x2}, false},
+		{[]byte{0xff}, false},
+		{nil, false},
+	}
+	for _, test := range tests {
+		if isText(test.data) != test.text {
+			t.Errorf("isText(% x) is %v", test.data, !test.text)
+		}
+	}
+}
+
+func TestLoadImage(t *testing.T) {
+	dir := t.TempDir()
+	image := testImage(40)
+	files := map[string][]byte{
+		"image.bin": image,
+		"image.hex": encodeASCIIHex(image, 0, &firmwareProfiles[0]),
+		"image.abs": encodeHp64K(image, 0, &firmwareProfiles[0]),
+	}
+	for name, data := range files {
+		filename := filepath.Join(dir, name)
+		if err := os.WriteFile(filename, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := loadImage(filename)
+		if err != nil {
+			t.Errorf("%v: %v", name, err)
+			continue
+		}
+		if !bytes.Equal(loaded, image) {
+			t.Errorf("%v: loaded image differs", name)
+		}
+	}
+}
+
+func TestLoadImageByExtension(t *testing.T) {
+	dir := t.TempDir()
+	asciiHex := []byte("[#00000000,01,02,\r")
+	tests := []struct {
+		name  string
+		data  []byte
+		image []byte
+		ok    bool
+	}{
+		{"printable.bin", asciiHex, asciiHex, true},
+		{"dump.rom", []byte("# comment\r\n"), []byte("# comment\r\n"), true},
+		{"capture.hex", asciiHex, []byte{1, 2}, true},
+		{"capture.TXT", asciiHex, []byte{1, 2}, true},
+		{"dump.dump", []byte("00000000  aa bb\n"), []byte{0xaa, 0xbb}, true},
+		{"binary.hex", []byte{0x1, 0xff}, nil, false},
+		{"empty.hex", []byte("hello\n"), nil, false},
+	}
+	for _, test := range tests {
+		filename := filepath.Join(dir, test.name)
+		if err := os.WriteFile(filename, test.data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		image, err := loadImage(filename)
+		if (err == nil) != test.ok {
+			t.Errorf("%v: error %v", test.name, err)
+			continue
+		}
+		if !bytes.Equal(image, test.image) {
+			t.Errorf("%v: image % x, want % x", test.name, image, test.image)
+		}
+	}
+}
+
+func TestSliceRange(t *testing.T) {
+	data := []byte{0, 1, 2, 3, 4, 5}
+	tests := []struct {
+		start  int
+		length int
+		slice  []byte
+	}{
+		{0, -1, data},
+		{2, 3, []byte{2, 3, 4}},
+		{4, 10, []byte{4, 5}},
+		{6, -1, []byte{}},
+		{10, 2, []byte{}},
+	}
+	for _, test := range tests {
+		if slice := sliceRange(data, test.start, test.length); !bytes.Equal(slice, test.slice) {
+			t.Errorf("sliceRange(%v, %v) = % x, want % x", test.start, test.length, slice, test.slice)
+		}
+	}
+}
+
+func TestPlaceBytes(t *testing.T) {
+	tests := []struct {
+		image   []byte
+		address uint32
+		values  []byte
+		result  []byte
+	}{
+		{nil, 0, []byte{1, 2}, []byte{1, 2}},
+		{nil, 3, []byte{1}, []byte{0xff, 0xff, 0xff, 1}},
+		{[]byte{1, 2, 3, 4}, 1, []byte{9}, []byte{1, 9, 3, 4}},
+		{[]byte{1, 2}, 1, []byte{8, 9}, []byte{1, 8, 9}},
+	}
+	for _, test := range tests {
+		if result := placeBytes(test.image, test.address, test.values); !bytes.Equal(result, test.result) {
+			t.Errorf("placeBytes(% x, %v, % x) = % x, want % x", test.image, test.address, test.values, result, test.result)
+		}
+	}
+}
+
+func TestParseNumber(t *testing.T) {
+	tests := []struct {
+		text  string
+		value int
+		ok    bool
+	}{
+		{"", 7, true},
+		{"16", 16, true},
+		{"0x100", 0x100, true},
+		{"-1", 0, false},
+		{"abc", 0, false},
+	}
+	for _, test := range tests {
+		value, err := parseNumber(test.text, 7)
+		if value != test.value || (err == nil) != test.ok {
+			t.Errorf("parseNumber(%q) = %v, %v", test.text, value, err)
+		}
+	}
+}
+
+func TestImageOperations(t *testing.T) {
+	tests := []struct {
+		name   string
+		result []byte
+		want   []byte
+	}{
+		{"pad", padImage([]byte{1, 2}, 4, 0xff), []byte{1, 2, 0xff, 0xff}},
+		{"pad smaller size", padImage([]byte{1, 2, 3}, 2, 0xff), []byte{1, 2, 3}},
+		{"trim", trimImage([]byte{1, 0xff, 2, 0xff, 0xff}, 0xff), []byte{1, 0xff, 2}},
+		{"trim fill 0", trimImage([]byte{1, 0, 0}, 0), []byte{1}},
+		{"trim all", trimImage([]byte{0xff, 0xff}, 0xff), []byte{}},
+		{"round", roundImage(testImage(17), 16, 0xff)[16:], append([]byte{testImage(17)[16]}, bytes.Repeat([]byte{0xff}, 15)...)},
+		{"round on boundary", roundImage([]byte{1, 2, 3, 4}, 4, 0xff), []byte{1, 2, 3, 4}},
+		{"round boundary 1", roundImage([]byte{1, 2, 3}, 1, 0xff), []byte{1, 2, 3}},
+	}
+	for _, test := range tests {
+		if !bytes.Equal(test.result, test.want) {
+			t.Errorf("%v: % x, want % x", test.name, test.result, test.want)
+		}
+	}
+}
+
+func TestPrepareUploadImage(t *testing.T) {
+	tests := []struct {
+		name string
+		ando AndoConnection
+		size int
+	}{
+		{"unchanged", AndoConnection{lanes: 1, rangeLength: -1}, 40},
+		{"range", AndoConnection{lanes: 1, rangeStart: 8, rangeLength: 16}, 16},
+		{"round", AndoConnection{lanes: 1, rangeLength: -1, round: true}, 48},
+		{"pad to ROM type", AndoConnection{lanes: 1, rangeLength: -1, pad: true, romType: findRomType("2716")}, 2048},
+		{"pad behind offset", AndoConnection{lanes: 1, rangeLength: -1, pad: true, offset: 0x400, romType: findRomType("2716")}, 1024},
+		{"pad without ROM type", AndoConnection{lanes: 1, rangeLength: -1, pad: true}, 40},
+		{"lane", AndoConnection{lanes: 2, lane: 1, rangeLength: -1}, 20},
+	}
+	for _, test := range tests {
+		test.ando.fill = 0xff
+		if image := prepareUploadImage(&test.ando, testImage(40)); len(image) != test.size {
+			t.Errorf("%v: %v bytes, want %v", test.name, len(image), test.size)
+		}
+	}
+}
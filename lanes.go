@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Images for 16-bit and 32-bit CPUs are split into byte lanes, one EPROM per lane.
+// For a 68000 image (2 lanes) lane 0 holds all even, lane 1 all odd bytes,
+// like the IC10/IC11 firmware pairs in roms/.
+
+// splitImage splits image into byte lanes. Byte i of image goes to lane i%lanes.
+func splitImage(image []byte, lanes int) [][]byte {
+	result := make([][]byte, lanes)
+	for i, b := range image {
+		result[i%lanes] = append(result[i%lanes], b)
+	}
+	return result
+}
+
+// mergeImages interleaves byte lanes into one image. All lanes must have same size.
+func mergeImages(lanes [][]byte) ([]byte, error) {
+	var image []byte
+	for i, lane := range lanes {
+		if len(lane) != len(lanes[0]) {
+			return nil, fmt.Errorf("lane %v has %v bytes, lane 0 has %v bytes", i, len(lane), len(lanes[0]))
+		}
+	}
+	for pos := range lanes[0] {
+		for _, lane := range lanes {
+			image = append(image, lane[pos])
+		}
+	}
+	return image, nil
+}
+
+// insertLane writes data as byte lane into image. Image is extended (filled with 0xff) if required.
+func insertLane(image []byte, data []byte, lane int, lanes int) []byte {
+	for len(image) < len(data)*lanes {
+		image = append(image, 0xff)
+	}
+	for i, b := range data {
+		image[i*lanes+lane] = b
+	}
+	return image
+}
+
+// laneFileName returns binary file name for lane of image file, e.g. "fw.hex" -> "fw-lane1.bin".
+// Lanes are always written as binary, so the extension of the image file is replaced.
+func laneFileName(filename string, lane int) string {
+	pos := strings.LastIndex(filename, ".")
+	if pos <= strings.LastIndex(filename, "/") {
+		pos = len(filename)
+	}
+	return fmt.Sprintf("%v-lane%v.bin", filename[:pos], lane)
+}
+
+// printLaneChecksums prints checksums of all lanes, one line per chip
+func printLaneChecksums(lanes [][]byte) {
+	for i, lane := range lanes {
+		sums := computeChecksums(lane, 0, -1)
+		fmt.Printf("lane %v: %v bytes, sum16 %04x, crc32 %08x, sha1 %v\n\r", i, len(lane), sums.sum16, sums.crc32, sums.sha1)
+	}
+}
+
+// splitFile splits image file into lanes files
+func splitFile(ando *AndoConnection, filename string, lanes int) bool {
+	image, err := loadImage(filename)
+	if err != nil {
+		logf(ando, "Error loading file %s: %s\n\r", filename, err)
+		return false
+	}
+	if len(image)%lanes != 0 {
+		logf(ando, "Warning: image size %v is not a multiple of %v lanes\n\r", len(image), lanes)
+	}
+	result := splitImage(image, lanes)
+	for i, lane := range result {
+		laneFile := laneFileName(filename, i)
+		err := os.WriteFile(laneFile, lane, 0644)
+		if err != nil {
+			logf(ando, "Error Writing file %s\n\r", err)
+			return false
+		}
+		logf(ando, "Wrote lane %v to %v\n\r", i, laneFile)
+	}
+	printLaneChecksums(result)
+	return true
+}
+
+// mergeFiles merges lane files into image file
+func mergeFiles(ando *AndoConnection, filename string, laneFiles []string) bool {
+	var lanes [][]byte
+	for _, laneFile := range laneFiles {
+		lane, err := loadImage(laneFile)
+		if err != nil {
+			logf(ando, "Error loading file %s: %s\n\r", laneFile, err)
+			return false
+		}
+		lanes = append(lanes, lane)
+	}
+	printLaneChecksums(lanes)
+	image, err := mergeImages(lanes)
+	if err != nil {
+		logf(ando, "Error merging lanes: %s\n\r", err)
+		return false
+	}
+	err = os.WriteFile(filename, image, 0644)
+	if err != nil {
+		logf(ando, "Error Writing file %s\n\r", err)
+		return false
+	}
+	logf(ando, "Wrote %v bytes to %v\n\r", len(image), filename)
+	return true
+}
+
+// selectLane returns lane ando.lane of image if lanes are used, otherwise image as it is
+func selectLane(ando *AndoConnection, image []byte) []byte {
+	if ando.lanes <= 1 {
+		return image
+	}
+	lanes := splitImage(image, ando.lanes)
+	logf(ando, "Using lane %v of %v, %v bytes\n\r", ando.lane, ando.lanes, len(lanes[ando.lane]))
+	printLaneChecksums(lanes[ando.lane : ando.lane+1])
+	return lanes[ando.lane]
+}
+
+// writeLaneToFile writes data downloaded last as lane ando.lane into interleaved image file
+// <outfile>-interleaved.bin. Other lanes in that file are kept, so all chips of a set can be read one by one.
+func writeLaneToFile(ando *AndoConnection) {
+	filename := ando.downloadFile + "-interleaved.bin"
+	image, err := os.ReadFile(filename)
+	if err != nil && !os.IsNotExist(err) {
+		logf(ando, "Error loading file %s: %s\n\r", filename, err)
+		return
+	}
+	image = insertLane(image, downloadedImage(ando), ando.lane, ando.lanes)
+	err = os.WriteFile(filename, image, 0644)
+	if err != nil {
+		logf(ando, "Error Writing file %s\n\r", err)
+		return
+	}
+	logf(ando, "Wrote lane %v of %v into %v (%v bytes)\n\r", ando.lane, ando.lanes, filename, len(image))
+	printLaneChecksums(splitImage(image, ando.lanes))
+}
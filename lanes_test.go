@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSplitImage(t *testing.T) {
+	tests := []struct {
+		image []byte
+		lanes int
+		split [][]byte
+	}{
+		{[]byte{0, 1, 2, 3, 4, 5}, 2, [][]byte{{0, 2, 4}, {1, 3, 5}}},
+		{[]byte{0, 1, 2, 3, 4, 5, 6, 7}, 4, [][]byte{{0, 4}, {1, 5}, {2, 6}, {3, 7}}},
+		{[]byte{0, 1, 2}, 2, [][]byte{{0, 2}, {1}}},
+	}
+	for _, test := range tests {
+		if split := splitImage(test.image, test.lanes); !reflect.DeepEqual(split, test.split) {
+			t.Errorf("splitImage(% x, %v) = %v, want %v", test.image, test.lanes, split, test.split)
+		}
+	}
+}
+
+func TestMergeImages(t *testing.T) {
+	for _, lanes := range []int{2, 4} {
+		image := testImage(64)
+		merged, err := mergeImages(splitImage(image, lanes))
+		if err != nil || !bytes.Equal(merged, image) {
+			t.Errorf("%v lanes: split and merge gave % x, %v", lanes, merged, err)
+		}
+	}
+	if _, err := mergeImages([][]byte{{1, 2}, {3}}); err == nil {
+		t.Errorf("lanes of different size merged")
+	}
+}
+
+func TestInsertLane(t *testing.T) {
+	image := insertLane(nil, []byte{1, 2}, 1, 2)
+	if !bytes.Equal(image, []byte{0xff, 1, 0xff, 2}) {
+		t.Errorf("insertLane into empty image gave % x", image)
+	}
+	image = insertLane(image, []byte{3, 4}, 0, 2)
+	if !bytes.Equal(image, []byte{3, 1, 4, 2}) {
+		t.Errorf("insertLane gave % x", image)
+	}
+}
+
+func TestLaneFileName(t *testing.T) {
+	tests := []struct {
+		filename string
+		lane     int
+		name     string
+	}{
+		{"fw.bin", 1, "fw-lane1.bin"},
+		{"dir.d/fw", 0, "dir.d/fw-lane0.bin"},
+		{"roms/fw.hex", 2, "roms/fw-lane2.bin"},
+		{"roms/fw.bin.abs", 3, "roms/fw.bin-lane3.bin"},
+	}
+	for _, test := range tests {
+		if name := laneFileName(test.filename, test.lane); name != test.name {
+			t.Errorf("laneFileName(%v, %v) = %v, want %v", test.filename, test.lane, name, test.name)
+		}
+	}
+}
+
+func TestSplitLanesArgument(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "fw.bin")
+	if err := os.WriteFile(filename, testImage(16), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ando := &AndoConnection{lanes: 1}
+	tests := []struct {
+		lanes    string
+		exitCode int
+	}{
+		{"2", ExitOK},
+		{"4", ExitOK},
+		{"x", ExitError},
+		{"1", ExitError},
+		{"-2", ExitError},
+	}
+	for _, test := range tests {
+		if exitCode := runBatch(ando, []string{"split", filename, test.lanes}); exitCode != test.exitCode {
+			t.Errorf("split with lanes %q gave exit code %v, want %v", test.lanes, exitCode, test.exitCode)
+		}
+	}
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// In line mode (: l or --line-mode) keyboard input is edited as a line and sent to EPrommer on Enter,
+// instead of forwarding every key. Lines are kept in a history, which is saved to a file.
+
+// historyMaxLines number of lines kept in history
+const historyMaxLines = 500
+
+// History lines entered in line mode
+type History struct {
+	lines []string
+	file  string // file history is saved to, "" if not saved
+}
+
+// Completer returns candidates for word typed, words are the words in front of it
+type Completer func(words []string, word string) []string
+
+// LineEditor line being edited
+type LineEditor struct {
+	prompt    string
+	line      []byte
+	cursor    int       // position in line
+	history   *History  // nil if there is no history
+	completer Completer // nil if there is no tab completion
+	index     int       // line of history shown, len(history.lines) for line being edited
+	edited    []byte    // line being edited while history is shown
+}
+
+// defaultHistoryFile returns name of history file in home directory, "" if there is no home directory
+func defaultHistoryFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".AndoPromacUI_history")
+}
+
+// loadHistory loads history from file, a missing file gives an empty history
+func loadHistory(file string) *History {
+	history := &History{file: file}
+	if file == "" {
+		return history
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return history
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" {
+			history.lines = append(history.lines, line)
+		}
+	}
+	if len(history.lines) > historyMaxLines {
+		history.lines = history.lines[len(history.lines)-historyMaxLines:]
+	}
+	return history
+}
+
+// add adds line to history and appends it to history file. Repeated lines are kept once.
+func (history *History) add(line string) {
+	if line == "" || (len(history.lines) > 0 && history.lines[len(history.lines)-1] == line) {
+		return
+	}
+	history.lines = append(history.lines, line)
+	if len(history.lines) > historyMaxLines {
+		history.lines = history.lines[1:]
+	}
+	if history.file == "" {
+		return
+	}
+	file, err := os.OpenFile(history.file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		log.Printf("Error opening history %s\n\r", err)
+		return
+	}
+	defer file.Close()
+	_, err = file.WriteString(line + "\n")
+	if err != nil {
+		log.Printf("Error writing history %s\n\r", err)
+	}
+}
+
+// editLine reads a line of text from keyboard (stdin in raw mode). The line can be edited with cursor keys,
+// Home/End, Backspace/Delete, Ctrl-A/E/U/K, Up/Down recall lines of history (if not nil), Tab completes
+// word in front of cursor (if completer is not nil). Returns false if input was cancelled with ESC or Ctrl-C.
+func editLine(consoleReader *bufio.Reader, prompt string, history *History, completer Completer) (string, bool) {
+	editor := LineEditor{history: history, completer: completer}
+	// text up to last line break of prompt is printed once, the rest is shown in front of the line
+	if pos := strings.LastIndexAny(prompt, "\r\n"); pos >= 0 {
+		if terminalUI == nil || terminalUI.isPaused() {
+			fmt.Fprint(terminalOutput, prompt[:pos+1])
+		}
+		prompt = prompt[pos+1:]
+	}
+	editor.prompt = prompt
+	if history != nil {
+		editor.index = len(history.lines)
+	}
+	for {
+		editor.show()
+		b, err := consoleReader.ReadByte()
+		if err != nil {
+			editor.finish(false)
+			return "", false
+		}
+		switch b {
+		case '\r', '\n':
+			if b == '\r' && consoleReader.Buffered() > 0 {
+				// pasted line ending CR LF
+				if next, _ := consoleReader.Peek(1); next[0] == '\n' {
+					consoleReader.ReadByte()
+				}
+			}
+			editor.finish(true)
+			return string(editor.line), true
+		case 0x7f, 0x8:
+			// backspace
+			if editor.cursor > 0 {
+				editor.cursor--
+				editor.delete()
+			}
+		case 0x3:
+			editor.finish(false)
+			return "", false
+		case 0x1b:
+			if consoleReader.Buffered() == 0 {
+				// ESC key itself cancels input
+				editor.finish(false)
+				return "", false
+			}
+			editor.cursorKey(readCursorKey(consoleReader))
+		case 0x1:
+			editor.cursor = 0
+		case 0x5:
+			editor.cursor = len(editor.line)
+		case 0x4:
+			editor.delete()
+		case 0xb:
+			editor.line = editor.line[:editor.cursor]
+		case 0x15:
+			editor.line = editor.line[editor.cursor:]
+			editor.cursor = 0
+		case '\t':
+			editor.complete()
+		default:
+			if b >= 0x20 && b < 0x7f {
+				editor.insert(b)
+			}
+		}
+	}
+}
+
+// cursorKey handles key returned by readCursorKey
+func (editor *LineEditor) cursorKey(key byte) {
+	switch key {
+	case 'C':
+		if editor.cursor < len(editor.line) {
+			editor.cursor++
+		}
+	case 'D':
+		if editor.cursor > 0 {
+			editor.cursor--
+		}
+	case 'H':
+		editor.cursor = 0
+	case 'F':
+		editor.cursor = len(editor.line)
+	case '3':
+		editor.delete()
+	case 'A':
+		if editor.history != nil && editor.index > 0 {
+			if editor.index == len(editor.history.lines) {
+				editor.edited = editor.line
+			}
+			editor.index--
+			editor.setLine([]byte(editor.history.lines[editor.index]))
+		}
+	case 'B':
+		if editor.history != nil && editor.index < len(editor.history.lines) {
+			editor.index++
+			if editor.index == len(editor.history.lines) {
+				editor.setLine(editor.edited)
+			} else {
+				editor.setLine([]byte(editor.history.lines[editor.index]))
+			}
+		}
+	}
+}
+
+// complete completes word in front of cursor. Several candidates are completed up to their common
+// prefix, if that does not add anything they are listed.
+func (editor *LineEditor) complete() {
+	if editor.completer == nil {
+		editor.insert(' ')
+		return
+	}
+	before := string(editor.line[:editor.cursor])
+	start := strings.LastIndex(before, " ") + 1
+	word := before[start:]
+	candidates := editor.completer(strings.Fields(before[:start]), word)
+	if len(candidates) == 0 {
+		return
+	}
+	completion := candidates[0]
+	for _, candidate := range candidates[1:] {
+		for !strings.HasPrefix(candidate, completion) {
+			completion = completion[:len(completion)-1]
+		}
+	}
+	if len(candidates) == 1 {
+		completion += " "
+	} else if len(completion) <= len(word) {
+		if terminalUI != nil && !terminalUI.isPaused() {
+			fmt.Printf("%v\n\r", strings.Join(candidates, "  "))
+		} else {
+			fmt.Fprintf(terminalOutput, "\n\r%v\n\r", strings.Join(candidates, "  "))
+		}
+		return
+	}
+	rest := editor.line[editor.cursor:]
+	editor.line = append([]byte(before[:start]+completion), rest...)
+	editor.cursor = start + len(completion)
+}
+
+// setLine replaces line, cursor is placed at end
+func (editor *LineEditor) setLine(line []byte) {
+	editor.line = append([]byte(nil), line...)
+	editor.cursor = len(editor.line)
+}
+
+// insert inserts char at cursor
+func (editor *LineEditor) insert(b byte) {
+	editor.line = append(editor.line, 0)
+	copy(editor.line[editor.cursor+1:], editor.line[editor.cursor:])
+	editor.line[editor.cursor] = b
+	editor.cursor++
+}
+
+// delete deletes char at cursor
+func (editor *LineEditor) delete() {
+	if editor.cursor < len(editor.line) {
+		editor.line = append(editor.line[:editor.cursor], editor.line[editor.cursor+1:]...)
+	}
+}
+
+// show shows prompt and line, in footer of terminal UI or in current line of terminal
+func (editor *LineEditor) show() {
+	if terminalUI != nil && !terminalUI.isPaused() {
+		terminalUI.setInput(editor.prompt, string(editor.line), editor.cursor)
+		return
+	}
+	fmt.Fprintf(terminalOutput, "\r\x1b[K%v%s", editor.prompt, editor.line)
+	if back := len(editor.line) - editor.cursor; back > 0 {
+		fmt.Fprintf(terminalOutput, "\x1b[%dD", back)
+	}
+}
+
+// finish ends input, line entered is kept in log of terminal UI
+func (editor *LineEditor) finish(entered bool) {
+	if terminalUI != nil && !terminalUI.isPaused() {
+		terminalUI.setInput("", "", 0)
+		if entered {
+			fmt.Printf("%v%s\n\r", editor.prompt, editor.line)
+		}
+		return
+	}
+	fmt.Fprint(terminalOutput, "\n\r")
+}
+
+// parseKeyLine returns keys to send for a line entered in line mode. Blanks separate keys, <SPACE> and
+// <CR> stand for these keys. A CR is added unless the line ends with <SPACE> or <CR>.
+// Example: "P D" -> "PD\r", "R <SPACE>" -> "R ".
+func parseKeyLine(line string) string {
+	sb := new(strings.Builder)
+	named := false
+	for _, field := range strings.Fields(line) {
+		for field != "" {
+			upper := strings.ToUpper(field)
+			named = true
+			if strings.HasPrefix(upper, "<SPACE>") {
+				sb.WriteByte(' ')
+				field = field[len("<SPACE>"):]
+			} else if strings.HasPrefix(upper, "<CR>") {
+				sb.WriteByte('\r')
+				field = field[len("<CR>"):]
+			} else {
+				sb.WriteByte(field[0])
+				field = field[1:]
+				named = false
+			}
+		}
+	}
+	if !named {
+		sb.WriteByte('\r')
+	}
+	return sb.String()
+}
+
+// runCommandLine handles a line entered in line mode: ':' followed by a key runs a compound command,
+// a named command is run, anything else is sent to EPrommer
+func runCommandLine(ando *AndoConnection, consoleReader *bufio.Reader, line string) {
+	line = strings.TrimSpace(line)
+	ando.history.add(line)
+	if strings.HasPrefix(line, ":") {
+		key := strings.TrimSpace(line[1:])
+		if key != "" {
+			compoundCommand(ando, consoleReader, key[0])
+		}
+		return
+	}
+	if runNamedCommand(ando, consoleReader, line) {
+		return
+	}
+	sendKeys(ando, parseKeyLine(line))
+}
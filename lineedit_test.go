@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseKeyLine(t *testing.T) {
+	tests := []struct {
+		line string
+		keys string
+	}{
+		{"P D", "PD\r"},
+		{"PD", "PD\r"},
+		{"R <SPACE>", "R "},
+		{"r <space>", "r "},
+		{"U5<SPACE><CR>", "U5 \r"},
+		{"<CR>", "\r"},
+		{"", "\r"},
+	}
+	for _, test := range tests {
+		if keys := parseKeyLine(test.line); keys != test.keys {
+			t.Errorf("parseKeyLine(%q) = %q, want %q", test.line, keys, test.keys)
+		}
+	}
+}
+
+func TestHistory(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "history")
+	history := loadHistory(file)
+	for _, line := range []string{"P D", "P D", "", "R <SPACE>", ": d"} {
+		history.add(line)
+	}
+	lines := []string{"P D", "R <SPACE>", ": d"}
+	if !reflect.DeepEqual(history.lines, lines) {
+		t.Errorf("history %q, want %q", history.lines, lines)
+	}
+	if loaded := loadHistory(file); !reflect.DeepEqual(loaded.lines, lines) {
+		t.Errorf("history loaded %q, want %q", loaded.lines, lines)
+	}
+	if missing := loadHistory(filepath.Join(t.TempDir(), "missing")); len(missing.lines) != 0 {
+		t.Errorf("history of missing file %q, want none", missing.lines)
+	}
+
+	long := &History{}
+	for i := 0; i < historyMaxLines+5; i++ {
+		long.add(strings.Repeat("x", i+1))
+	}
+	if len(long.lines) != historyMaxLines || long.lines[0] != strings.Repeat("x", 6) {
+		t.Errorf("history keeps %v lines starting with %q, want %v", len(long.lines), long.lines[0], historyMaxLines)
+	}
+}
+
+func TestEditLine(t *testing.T) {
+	terminalOutput = io.Discard
+	defer func() { terminalOutput = os.Stdout }()
+	completer := func(words []string, word string) []string {
+		var candidates []string
+		for _, candidate := range []string{"blank", "burn", "download"} {
+			if strings.HasPrefix(candidate, word) {
+				candidates = append(candidates, candidate)
+			}
+		}
+		return candidates
+	}
+	tests := []struct {
+		name  string
+		input string
+		line  string
+		ok    bool
+	}{
+		{"plain", "PD\r", "PD", true},
+		{"CR LF", "PD\r\nnext", "PD", true},
+		{"backspace", "PX\x7fD\r", "PD", true},
+		{"cursor left insert", "PD\x1b[D \r", "P D", true},
+		{"home end", "D\x1b[HP\x1b[F!\r", "PD!", true},
+		{"ctrl-a ctrl-e", "D\x01P\x05!\r", "PD!", true},
+		{"delete", "XPD\x01\x1b[3~\r", "PD", true},
+		{"ctrl-k", "PDXX\x1b[D\x1b[D\x0b\r", "PD", true},
+		{"ctrl-u", "XXPD\x1b[D\x1b[D\x15\r", "PD", true},
+		{"history up", "\x1b[A\r", ": d", true},
+		{"history up down", "new\x1b[A\x1b[A\x1b[B\x1b[B\r", "new", true},
+		{"complete unique", "dow\t\r", "download ", true},
+		{"complete common prefix", "b\t\r", "b", true},
+		{"complete prefix", "bu\t\r", "burn ", true},
+		{"escape", "PD\x1b", "", false},
+		{"ctrl-c", "PD\x03", "", false},
+		{"end of input", "PD", "", false},
+	}
+	for _, test := range tests {
+		history := &History{lines: []string{"R <SPACE>", ": d"}}
+		reader := bufio.NewReader(strings.NewReader(test.input))
+		line, ok := editLine(reader, "\n\rLine > ", history, completer)
+		if line != test.line || ok != test.ok {
+			t.Errorf("%v: editLine() = %q, %v, want %q, %v", test.name, line, ok, test.line, test.ok)
+		}
+	}
+}
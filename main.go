@@ -5,7 +5,9 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"os"
@@ -17,6 +19,8 @@ func main() {
 	fmt.Println("Ando/Promac EPROM Programmer Communication UI")
 	devicePtr := flag.String("device", "/dev/ttyUSB0",
 		"TTY device used to access EPrommer")
+	devicesPtr := flag.String("devices", "",
+		"Comma separated list of TTY devices to run the batch job on in parallel (gang mode)")
 	dryRunPtr := flag.Bool("dry-run", false,
 		"Dry run mode")
 	debugPtr := flag.Int("debug", 0,
@@ -29,41 +33,183 @@ func main() {
 		"Input file for EPROM data to upload to EPrommer")
 	downloadPtr := flag.String("outfile", "out",
 		"Output file for EPROM data downloaded from EPrommer")
+	referencePtr := flag.String("reference", "",
+		"Reference file to verify downloaded EPROM data against (default: --infile)")
+	maxDiffsPtr := flag.Int("max-diffs", 16,
+		"Maximum number of differing bytes listed by verify")
+	copyPtr := flag.Bool("copy", false,
+		"Copy socket EPROM into EPrommer RAM buffer (DEVICE-COPY) before download in batch mode")
+	sumRangePtr := flag.String("sum-range", "",
+		"Range start:length checksums are calculated over (default: complete image)")
+	catalogPtr := flag.String("catalog", "",
+		"Directory or file with known ROM images (DAT/CSV files or images) to identify downloaded data "+
+			"(default: "+defaultCatalog+" if it exists)")
+	modelPtr := flag.String("model", "Ando AF-9704",
+		"EPrommer model, stored with every dump")
+	firmwarePtr := flag.String("firmware", defaultFirmwareProfile.name,
+		"EPrommer firmware version (21.7, 21.9)")
+	notePtr := flag.String("note", "",
+		"Operator note, stored with every dump")
+	romTypePtr := flag.String("rom-type", "",
+		"ROM type to select on EPrommer at start (e.g. 2764)")
+	lanesPtr := flag.Int("lanes", 1,
+		"Number of byte lanes (chips) of image, 2 for 16-bit and 4 for 32-bit ROM sets")
+	lanePtr := flag.Int("lane", 0,
+		"Byte lane (chip) to upload from --infile or to download into <outfile>-interleaved.bin")
+	startPtr := flag.String("start", "",
+		"Start address of range used from --infile on upload or from RAM buffer on download")
+	lengthPtr := flag.String("length", "",
+		"Length of range used on upload or download (default: up to end)")
+	offsetPtr := flag.String("offset", "",
+		"Address in RAM buffer (upload) or output file (download) the range is placed at")
+	fillPtr := flag.String("fill", "0xff",
+		"Fill byte used for padding, rounding and trimming images")
+	padPtr := flag.Bool("pad", false,
+		"Pad upload image with fill byte up to size of selected ROM type")
+	trimPtr := flag.Bool("trim", false,
+		"Trim trailing fill bytes of upload image and of data written with : w")
+	roundPtr := flag.Bool("round", false,
+		"Round upload image with fill byte up to a multiple of 16 bytes (record size)")
+	forcePtr := flag.Bool("force", false,
+		"Upload even if image is larger than selected ROM type")
+	httpPtr := flag.String("http", "",
+		"Address to serve HTTP API on while interactive UI is running (e.g. 127.0.0.1:8080)")
+	tuiPtr := flag.Bool("tui", false,
+		"Full-screen terminal UI with separate panes for EPrommer output and log")
+	lineModePtr := flag.Bool("line-mode", false,
+		"Start in line mode: keyboard input is edited as a line and sent on Enter (': l' switches)")
+	historyPtr := flag.String("history", defaultHistoryFile(),
+		"File lines entered in line mode are kept in, \"\" to keep no history")
+	scriptPtr := flag.String("script", "",
+		"Run script file (steps like send, wait, upload, download, assert, see readme) and quit")
+	timeoutPtr := flag.Int("timeout", 300,
+		"Timeout in seconds for a transfer or device command in batch mode")
 	flag.Parse()
+	args := flag.Args()
+	if *scriptPtr != "" {
+		// script runs like batch job 'script'
+		args = []string{"script", *scriptPtr}
+		*batchPtr = true
+	}
+	if len(args) == 0 {
+		args = []string{"upload"}
+	}
+	if *referencePtr == "" {
+		*referencePtr = *uploadPtr
+	}
+	sumStart, sumLength, err := parseRange(*sumRangePtr)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if *lanesPtr < 1 || *lanePtr < 0 || *lanePtr >= *lanesPtr {
+		fmt.Printf("Lane %v is not in range of %v lanes\n", *lanePtr, *lanesPtr)
+		return
+	}
+	rangeStart, err := parseNumber(*startPtr, 0)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	rangeLength, err := parseNumber(*lengthPtr, -1)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	offset, err := parseNumber(*offsetPtr, 0)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fill, err := parseNumber(*fillPtr, 0xff)
+	if err != nil || fill > 0xff {
+		fmt.Printf("Illegal fill byte %v\n", *fillPtr)
+		return
+	}
+	var devices []string
+	if *devicesPtr != "" {
+		devices = strings.Split(*devicesPtr, ",")
+		if !*batchPtr {
+			fmt.Println("--devices (gang mode) requires --batch")
+			return
+		}
+	}
+	firmwareProfile := findFirmwareProfile(*firmwarePtr)
+	if firmwareProfile == nil {
+		fmt.Printf("Unknown firmware %v\n", *firmwarePtr)
+		return
+	}
 
 	fmt.Printf("--device, TTY Device: %s\n", *devicePtr)
+	if len(devices) > 0 {
+		fmt.Printf("--devices (gang mode): %s\n", strings.Join(devices, ", "))
+	}
 	fmt.Printf("--dry-run: %t\n", *dryRunPtr)
 	fmt.Printf("--debug: %d\n", *debugPtr)
 	fmt.Printf("--baudrate: %d\n", *baudratePtr)
 	fmt.Printf("--outfile: %s-<checksum>.bin\n", *downloadPtr)
-	fmt.Printf("--batch: %t (batch mode not yet supported)\n", *batchPtr)
+	fmt.Printf("--batch: %t (job: %s)\n", *batchPtr, strings.Join(args, " "))
 	fmt.Printf("--infile: %s\n", *uploadPtr)
+	fmt.Printf("--reference: %s\n", *referencePtr)
+	fmt.Printf("--firmware: %s\n", *firmwarePtr)
 
 	// Create serial connection
 	andoSerial := AndoSerialConnection{
 		nil, //priv
 		*devicePtr,
 		*baudratePtr,
-		0,
+		time.Duration(*timeoutPtr) * time.Second,
 	}
 
 	// Create Device structure
 	ando := AndoConnection{
-		1,           //priv
-		NormalInput, //priv
-		*dryRunPtr,
-		*debugPtr,
-		*batchPtr,
-		*uploadPtr,
-		*downloadPtr,
-		F_ASCIIHex, //F_HP64000ABS,F_ASCIIHex, F_GENERIC
-		&andoSerial,
-		nil,
-		0,
-		0,
-		nil,
-		time.Now(),
-		time.Now(),
+		continueLoop:   newContinueLoop(), //priv
+		state:          NormalInput,       //priv
+		dryMode:        *dryRunPtr,
+		debug:          *debugPtr,
+		batch:          *batchPtr,
+		model:          *modelPtr,
+		firmware:       firmwareProfile,
+		note:           *notePtr,
+		uploadFile:     *uploadPtr,
+		downloadFile:   *downloadPtr,
+		referenceFile:  *referencePtr,
+		maxDiffs:       *maxDiffsPtr,
+		copyFirst:      *copyPtr,
+		force:          *forcePtr,
+		selectRomType:  *romTypePtr,
+		lanes:          *lanesPtr,
+		lane:           *lanePtr,
+		rangeStart:     rangeStart,
+		rangeLength:    rangeLength,
+		offset:         offset,
+		fill:           byte(fill),
+		pad:            *padPtr,
+		trim:           *trimPtr,
+		round:          *roundPtr,
+		sumStart:       sumStart,
+		sumLength:      sumLength,
+		transferFormat: F_ASCIIHex, //F_HP64000ABS,F_ASCIIHex, F_GENERIC
+		serial:         &andoSerial,
+		generic:        new(GenericData),
+		sessionLock:    &sync.Mutex{},
+		consoleLock:    &sync.Mutex{},
+		transferHold:   make(chan struct{}, 1),
+		lineMode:       *lineModePtr,
+		startTime:      time.Now(),
+		stopTime:       time.Now(),
+	}
+
+	if *catalogPtr != "" {
+		ando.catalog = loadCatalog(*catalogPtr)
+	} else {
+		ando.catalog = loadDefaultCatalog()
+	}
+
+	if len(devices) > 0 {
+		exitCode := runGang(&ando, devices, args)
+		fmt.Printf("\n\rQuitting Ando/Promac EPROM Programmer Communication UI, exit code %v\n\r", exitCode)
+		os.Exit(exitCode)
 	}
 
 	if !ando.dryMode {
@@ -76,8 +222,19 @@ func main() {
 		defer ando.serial.tty.Close()
 	}
 
+	if args[0] == "daemon" {
+		exitCode := daemon(&ando, args)
+		fmt.Printf("\n\rQuitting Ando/Promac EPROM Programmer Communication UI, exit code %v\n\r", exitCode)
+		os.Exit(exitCode)
+	}
+
+	if args[0] == "serve" {
+		exitCode := serve(&ando, args)
+		fmt.Printf("\n\rQuitting Ando/Promac EPROM Programmer Communication UI, exit code %v\n\r", exitCode)
+		os.Exit(exitCode)
+	}
+
 	var oldState *term.State
-	var err error
 	if !ando.batch {
 		// switch stdin into 'raw' mode
 		oldState, err = term.MakeRaw(int(os.Stdin.Fd()))
@@ -87,21 +244,56 @@ func main() {
 		}
 		defer term.Restore(int(os.Stdin.Fd()), oldState)
 
+		if *tuiPtr {
+			terminalUI, err = startTUI(&ando)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+		}
+
+		// API server hooks into console output, so it is created before ttyReader runs
+		var api *APIServer
+		if *httpPtr != "" {
+			api = newAPIServer(&ando)
+		}
+
 		// Start local keyboard handler routine
+		ando.history = loadHistory(*historyPtr)
 		go localKeyboardReader(&ando)
 
 		// Start tty routine
 		go ttyReader(&ando)
 
+		if api != nil {
+			go func() {
+				err := runAPIServer(api, *httpPtr)
+				log.Printf("Error serving HTTP API: %s\n\r", err)
+			}()
+		}
+
+		if ando.selectRomType != "" {
+			selectRomType(&ando, ando.selectRomType)
+		}
+
 		// stay in loop until end condition is met
-		for ando.continueLoop > 0 {
+		for running(&ando) {
 			time.Sleep(25 * time.Millisecond)
 		}
 	} else {
-		// just upload
-		//uploadFile(&ando)
+		// Start tty routine
+		go ttyReader(&ando)
+		go reportProgress(&ando)
+
+		exitCode := runBatch(&ando, args)
+		stopRunning(&ando)
+		fmt.Printf("\n\rQuitting Ando/Promac EPROM Programmer Communication UI, exit code %v\n\r", exitCode)
+		os.Exit(exitCode)
 	}
 
+	if terminalUI != nil {
+		terminalUI.stop()
+	}
 	fmt.Println("\n\rQuitting Ando/Promac EPROM Programmer Communication UI\n\r")
 	if !ando.batch {
 		err := term.Restore(int(os.Stdin.Fd()), oldState)
@@ -118,61 +310,101 @@ func ttyReader(ando *AndoConnection) {
 	var lineNumber = 1
 	cbuf := make([]byte, 128)
 	errors := 0
-	for ando.continueLoop > 0 {
-		if ando.dryMode {
-			continue
-		}
+	if ando.dryMode {
+		// nothing is read in dry mode
+		return
+	}
+	for running(ando) {
 		// check Ando tty
 		num, err := ando.serial.tty.Read(cbuf)
 		if err != nil {
-			log.Printf("Error in Read: %s\n", err)
-			ando.continueLoop = 0
+			logf(ando, "Error in Read: %s\n", err)
+			stopRunning(ando)
 		} else {
-			endCriteriaReached := endCriteriaCheck(cbuf, ando.debug)
-			if endCriteriaReached {
+			chunk := cbuf[:num]
+			endCriteriaReached := endCriteriaCheck(ando, chunk)
+			if ando.state == NormalInput || ando.state == CommandInput || ando.state == Editing {
+				// '[PASS]' not waited for (keys sent by user or script), it is output like any other text
+				endCriteriaReached = false
+			}
+			failReached := false
+			failMessage := ""
+			if ando.state == SendData || ando.state == VerifyData || ando.state == DeviceCommand {
+				failReached, failMessage = failCriteriaCheck(ando, chunk)
+			}
+			if failReached {
+				if !ando.quiet {
+					fmt.Printf("%s", chunk)
+				}
+				captureConsole(ando, chunk)
+				handleDeviceFailure(ando, failMessage)
+			} else if endCriteriaReached {
 				if ando.state == ReceiveData {
 					// End of download data
 					ando.stopTime = time.Now()
-					log.Printf("Read %v raw bytes, in %.4v seconds\n\r", len(genericState.rawData), ando.stopTime.Sub(ando.startTime).Seconds())
+					logf(ando, "Read %v raw bytes, in %.4v seconds\n\r", len(ando.generic.rawData), ando.stopTime.Sub(ando.startTime).Seconds())
 					if errors > 0 {
-						log.Printf("There were %v errors on data download\n\r", errors)
+						logf(ando, "There were %v errors on data download\n\r", errors)
+						ando.transferErrors = errors
 						errors = 0
 					} else {
-						parseFormat(ando, errors, &lineNumber)
+						parseFormat(ando, &errors, &lineNumber)
 						if errors > 0 {
-							log.Printf("There were %v errors during parsing\n\r", errors)
+							logf(ando, "There were %v errors during parsing\n\r", errors)
+							ando.transferErrors = errors
 							errors = 0
 						} else {
-							log.Printf("Data receive completed. Read %v bytes in %v lines/records\n\r", (lineNumber-1)*16, lineNumber-1)
-							log.Printf("Checksum calculated: %06x\n\r", ando.checksum)
+							logf(ando, "Data receive completed. Read %v bytes in %v lines/records\n\r", (lineNumber-1)*16, lineNumber-1)
+							logf(ando, "Checksum calculated: %06x\n\r", ando.checksum)
+							image := downloadedImage(ando)
+							ando.checksums = computeChecksums(image, ando.sumStart, ando.sumLength)
+							printChecksums(ando.checksums)
+							ando.identified = identifyDownload(ando, image)
+							checkDownloadSize(ando, len(image))
 						}
 					}
 					lineNumber = 1
 				}
 				if ando.state == SendData {
 					// Device signals that upload was processed complete and without errors
-					log.Printf("\n\rUpload completed for all bytes from file %v\n\r", ando.uploadFile)
+					logf(ando, "\n\rUpload completed for all bytes from file %v\n\r", ando.uploadFile)
+				}
+				if ando.state == VerifyData {
+					// Device signals that all bytes sent are identical to its RAM buffer
+					logf(ando, "\n\rDevice verify PASSED for all bytes from file %v\n\r", ando.uploadFile)
 				}
-				if ando.state == ReceiveData || ando.state == SendData {
+				if ando.state == SendData || ando.state == VerifyData || ando.state == DeviceCommand {
+					ando.lastPassed = true
+					ando.lastReply = "PASS"
+				}
+				if ando.state == DeviceCommand {
+					// Device command completed, device is not in S-OUTPUT or S-INPUT state, so no RESET required
+					ando.state = NormalInput
+				}
+				if ando.state == ReceiveData || ando.state == SendData || ando.state == VerifyData {
 					// Data receive/send is complete
 					ando.state = NormalInput
 					// leave S-OUTPUT or S-INPUT state, by sending RESET character
-					bbuf := make([]byte, 1)
-					bbuf[0] = '@'
-					_, err := ando.serial.tty.Write(bbuf)
-					if err != nil {
-						log.Printf("Error in Write: %s\n", err)
-					}
+					sendKeys(ando, "@")
+					releaseTransferHold(ando)
 				}
 			} else {
 				if ando.state == ReceiveData {
 					// incoming data during download
 					handleGenericInput(ando, num, cbuf, &newLine, &lineNumber, &errors)
+				} else if ando.state == Editing {
+					// do not disturb hex editor screen
+					captureConsole(ando, chunk)
+				} else if ando.quiet {
+					// gang mode, output of several devices would be mixed up
+					captureConsole(ando, chunk)
 				} else {
 					// human-readable output, we just print it out
-					fmt.Printf("%s", cbuf)
+					fmt.Printf("%s", chunk)
+					captureConsole(ando, chunk)
 				}
 			}
+			publishStatus(ando)
 		}
 	}
 }
@@ -183,25 +415,24 @@ func ttyReader(ando *AndoConnection) {
 // 50 41 53 53     P A S S
 // 5d              ]
 var passPattern = []byte("[PASS]")
-var endCriteriaTest = 0
 
-func endCriteriaCheck(chunk []byte, debug int) bool {
+func endCriteriaCheck(ando *AndoConnection, chunk []byte) bool {
 	for _, b := range chunk {
-		if b == passPattern[endCriteriaTest] {
-			if debug > 1 {
-				log.Printf("C: Found '%v' string in byte stream\n\r", string(passPattern[:endCriteriaTest]))
+		if b == passPattern[ando.endCriteriaTest] {
+			if ando.debug > 1 {
+				logf(ando, "C: Found '%v' string in byte stream\n\r", string(passPattern[:ando.endCriteriaTest]))
 			}
-			endCriteriaTest++
-			if endCriteriaTest == len(passPattern) {
-				endCriteriaTest = 0
+			ando.endCriteriaTest++
+			if ando.endCriteriaTest == len(passPattern) {
+				ando.endCriteriaTest = 0
 				return true
 			}
 		} else {
 			// restart check
 			if b == passPattern[0] {
-				endCriteriaTest = 1
+				ando.endCriteriaTest = 1
 			} else {
-				endCriteriaTest = 0
+				ando.endCriteriaTest = 0
 			}
 		}
 	}
@@ -209,117 +440,151 @@ func endCriteriaCheck(chunk []byte, debug int) bool {
 	return false
 }
 
+// failCriteriaCheck checks if a result message other than '[PASS]' was received, e.g. '[FAIL]' or
+// an error message with an address. Like for endCriteriaCheck, the message may come in arbitrary chunks.
+// Returns true and the message text without brackets if a complete message was received.
+func failCriteriaCheck(ando *AndoConnection, chunk []byte) (bool, string) {
+	for _, b := range chunk {
+		if b == '[' {
+			ando.failCriteriaCollecting = true
+			ando.failMessage = ando.failMessage[:0]
+			continue
+		}
+		if !ando.failCriteriaCollecting {
+			continue
+		}
+		if b == ']' {
+			ando.failCriteriaCollecting = false
+			message := string(ando.failMessage)
+			if message != "PASS" {
+				return true, message
+			}
+			continue
+		}
+		if len(ando.failMessage) > 80 {
+			// no result message, the device would not send such a long one
+			ando.failCriteriaCollecting = false
+			continue
+		}
+		ando.failMessage = append(ando.failMessage, b)
+	}
+	return false, ""
+}
+
+// handleDeviceFailure handles a failure message sent by EPrommer as result of a command or transfer
+func handleDeviceFailure(ando *AndoConnection, message string) {
+	ando.lastPassed = false
+	ando.lastReply = message
+	logf(ando, "\n\rEPrommer reported failure: [%v]\n\r", message)
+	address, found := parseReplyAddress(message)
+	if found {
+		logf(ando, "Mismatch reported at address %08x\n\r", address)
+	}
+	if ando.state == SendData || ando.state == VerifyData {
+		// leave S-INPUT state, by sending RESET character
+		sendKeys(ando, "@")
+	}
+	ando.state = NormalInput
+	releaseTransferHold(ando)
+}
+
+// parseReplyAddress extracts a hex address (4 to 8 digits) from a result message sent by EPrommer
+func parseReplyAddress(message string) (uint32, bool) {
+	fields := strings.FieldsFunc(message, func(r rune) bool {
+		return r == ' ' || r == ',' || r == ':' || r == '='
+	})
+	for _, field := range fields {
+		if len(field) < 4 || len(field) > 8 {
+			continue
+		}
+		value, err := strconv.ParseUint(field, 16, 32)
+		if err == nil {
+			return uint32(value), true
+		}
+	}
+	return 0, false
+}
+
 // parseFormat calls function depending on transfer format
-func parseFormat(ando *AndoConnection, errors int, lineNumber *int) {
+func parseFormat(ando *AndoConnection, errors *int, lineNumber *int) {
 	if ando.transferFormat == F_GENERIC {
-		parseGeneric(ando, &errors)
+		parseGeneric(ando, errors)
 	}
 	if ando.transferFormat == F_HP64000ABS {
 		initHp64KFormat(ando)
-		parseHp64KFormat(ando, lineNumber, &errors)
+		parseHp64KFormat(ando, lineNumber, errors)
 	}
 	if ando.transferFormat == F_ASCIIHex {
-		parseASCIIHexFormat(ando, lineNumber, &errors)
+		parseASCIIHexFormat(ando, lineNumber, errors)
 	}
 }
 
 // localKeyboardReader handles all local keyboard input and interaction
 func localKeyboardReader(ando *AndoConnection) {
-	cbuf := make([]byte, 128)
-
 	consoleReader := bufio.NewReader(os.Stdin)
-	b := make([]byte, 1)
 	helpText(ando)
-	for ando.continueLoop > 0 {
-		if ando.state != CommandInput {
+	for running(ando) {
+		if ando.lineMode && ando.state == NormalInput {
+			// line mode, line is sent on Enter
+			line, ok := editLine(consoleReader, "Line > ", ando.history, completeCommand)
+			if ok && lockSession(ando) {
+				runCommandLine(ando, consoleReader, line)
+				unlockSession(ando)
+			}
+			continue
+		}
+		if ando.state != CommandInput && terminalUI == nil && consoleReader.Buffered() == 0 {
 			fmt.Printf("Command > ")
 		}
-		num, err := consoleReader.Read(cbuf)
+		c, err := consoleReader.ReadByte()
 		if err != nil {
 			fmt.Println(err)
 		} else {
-			if num == 0 {
-				continue
-			}
-			if num > 1 {
-				// We currently cannot handle multiple chars at once
-				fmt.Println("Multiple chars!")
-			}
-
 			if ando.state == CommandInput {
-				fmt.Printf("%s", cbuf)
+				fmt.Printf("%c", c)
 				// In command mode, execute command based on key input
-				if cbuf[0] == ':' {
+				if c == ':' {
 					ando.state = NormalInput
 					fmt.Println(" Back to normal input handling\n\r")
 					continue
 				}
-				if cbuf[0] == 'q' {
-					ando.continueLoop = 0
-					ando.state = NormalInput
-				}
-				if cbuf[0] == 'd' {
-					ando.startTime = time.Now()
-					ando.lineInfos = nil
-					ando.checksum = 0
-					initGenericFormat(ando)
-					endCriteriaTest = 0
-
-					fmt.Println("\n\r")
-					ando.state = ReceiveData
-					bbuf := make([]byte, 8)
-					bbuf[0] = 'U'
-					bbuf[1] = '7'
-					bbuf[2] = '\r'
-					_, err := ando.serial.tty.Write(bbuf)
-					if err != nil {
-						log.Printf("Error in Write: %s\n", err)
-					}
-				}
-				if cbuf[0] == 'w' {
-					ando.state = NormalInput
-					writeDataToFile(ando)
-				}
-				if cbuf[0] == 'u' {
-					ando.state = NormalInput
-					uploadFile(ando)
-				}
-				if cbuf[0] == 'f' {
-					if ando.transferFormat == F_ASCIIHex {
-						ando.transferFormat = F_HP64000ABS
-						setTransferFormat(ando, "HP64000ABS")
-						fmt.Println(" File format is now: HP64000ABS\n\r")
-					} else if ando.transferFormat == F_HP64000ABS {
-						ando.transferFormat = F_GENERIC
-						fmt.Println(" File format is now: Generic\n\r")
-					} else if ando.transferFormat == F_GENERIC {
-						ando.transferFormat = F_ASCIIHex
-						setTransferFormat(ando, "ASCII Hex")
-						fmt.Println(" File format is now: ASCII-Hex\n\r")
-					}
+				if lockSession(ando) {
+					compoundCommand(ando, consoleReader, c)
+					unlockSession(ando)
+				} else {
 					ando.state = NormalInput
 				}
 				continue
 			}
 
 			if ando.state == NormalInput {
-				if cbuf[0] == ':' {
+				if c == ':' {
 					// If ':' is selected, check next char for command to execute
 					// We switch state to CommandInput for that
 					ando.state = CommandInput
-					fmt.Print(" [:qdwuf] >")
+					if terminalUI == nil {
+						fmt.Print(" [:qdcwuvbptexflns] >")
+					}
 					continue
 				}
 			}
-			// Normal input, forward it to tty
-			b[0] = cbuf[0]
+			// Normal input, forward it to tty. Pasted text and escape sequences are forwarded completely.
+			keys := []byte{c}
+			for consoleReader.Buffered() > 0 {
+				b, _ := consoleReader.ReadByte()
+				if b == ':' && ando.state == NormalInput {
+					consoleReader.UnreadByte()
+					break
+				}
+				keys = append(keys, b)
+			}
 			if !ando.dryMode {
 				if ando.debug > 0 {
-					fmt.Printf("<%d:%s:%x>", num, b, b)
+					fmt.Printf("<%d:%s:%x>", len(keys), keys, keys)
 				} else {
-					_, err := ando.serial.tty.Write(b)
+					_, err := ando.serial.tty.Write(keys)
 					if err != nil {
-						log.Printf("Error in Write: %s\n", err)
+						logf(ando, "Error in Write: %s\n", err)
 					}
 				}
 			}
@@ -327,18 +592,181 @@ func localKeyboardReader(ando *AndoConnection) {
 	}
 }
 
-// parseFormat calls function depending on transfer format
+// compoundCommand executes compound command for key typed after ':'
+func compoundCommand(ando *AndoConnection, consoleReader *bufio.Reader, c byte) {
+	switch c {
+	case 'q':
+		stopRunning(ando)
+		ando.state = NormalInput
+	case 'd':
+		fmt.Println("\n\r")
+		startDownload(ando)
+	case 'c':
+		ando.state = NormalInput
+		fmt.Println("\n\r")
+		verifyDownload(ando)
+	case 'w':
+		ando.state = NormalInput
+		writeDataToFile(ando)
+	case 'u':
+		ando.state = NormalInput
+		uploadFile(ando)
+	case 't':
+		ando.state = NormalInput
+		name := readInputLine(consoleReader, "\n\rROM type (empty to query) > ")
+		if name != "" {
+			selectRomType(ando, name)
+		} else {
+			updateRomType(ando)
+			logf(ando, "ROM type: %v\n\r", romTypeName(ando))
+		}
+	case 'v':
+		ando.state = NormalInput
+		verifyFileOnDevice(ando)
+	case 'e':
+		ando.state = NormalInput
+		runHexEditor(ando, consoleReader)
+	case 'x':
+		ando.state = NormalInput
+		runDiffViewer(ando, consoleReader)
+	case 'b':
+		ando.state = NormalInput
+		fmt.Println("\n\r")
+		burn(ando)
+	case 'p':
+		ando.state = NormalInput
+		fmt.Println("\n\r")
+		if _, ok := programCheck(ando); ok {
+			logf(ando, "RAM buffer holds chip contents now, upload image with ': u' before DEVICE-PROGRAM\n\r")
+		}
+	case 'f':
+		if ando.transferFormat == F_ASCIIHex {
+			selectTransferFormat(ando, F_HP64000ABS)
+		} else if ando.transferFormat == F_HP64000ABS {
+			selectTransferFormat(ando, F_GENERIC)
+		} else if ando.transferFormat == F_GENERIC {
+			selectTransferFormat(ando, F_ASCIIHex)
+		}
+		fmt.Printf(" File format is now: %v\n\r\n", ando.transferFormat)
+		ando.state = NormalInput
+	case 'n':
+		ando.state = NormalInput
+		line, ok := editLine(consoleReader, "\n\rNamed command (Tab completes, help lists) > ", ando.history, completeCommand)
+		if ok && strings.TrimSpace(line) != "" {
+			ando.history.add(strings.TrimSpace(line))
+			if !runNamedCommand(ando, consoleReader, line) {
+				logf(ando, "Unknown command '%v', 'help' lists named commands\n\r", strings.TrimSpace(line))
+			}
+		}
+	case 's':
+		ando.state = NormalInput
+		file := readInputLine(consoleReader, "\n\rScript file > ")
+		if file != "" {
+			runScriptFile(ando, file, consoleReader)
+		}
+	case 'l':
+		ando.state = NormalInput
+		ando.lineMode = !ando.lineMode
+		if ando.lineMode {
+			logf(ando, "Line mode: keys are sent on Enter, ': l' switches back to single keys\n\r")
+		} else {
+			logf(ando, "Single key mode: every key is sent at once\n\r")
+		}
+	}
+}
+
+// readInputLine reads a line of text from keyboard (stdin in raw mode), input is echoed and can be edited
+func readInputLine(consoleReader *bufio.Reader, prompt string) string {
+	line, _ := editLine(consoleReader, prompt, nil, nil)
+	return line
+}
+
+// uploadFile uploads file to EPrommer's RAM buffer (U6). If data downloaded last was edited in
+// hex editor, the edited data is uploaded instead.
 func uploadFile(ando *AndoConnection) {
+	if len(ando.edits) > 0 {
+		logf(ando, "Uploading edited RAM buffer (%v bytes edited) instead of file %v\n\r", len(ando.edits), ando.uploadFile)
+		knownRomType(ando)
+		sendImage(ando, "U6\r", imageFromLineInfos(ando.lineInfos), 0, SendData)
+		return
+	}
+	sendFile(ando, "U6\r", SendData)
+}
+
+// verifyFileOnDevice sends file to EPrommer, which compares it with its RAM buffer (U8).
+// RAM buffer is not changed by this.
+func verifyFileOnDevice(ando *AndoConnection) {
+	sendFile(ando, "U8\r", VerifyData)
+}
+
+// sendFile sends command and then file in current transfer format to EPrommer
+func sendFile(ando *AndoConnection, command string, state ConnState) {
 	errors := 0
-	if ando.transferFormat == F_GENERIC {
-		//TBD
+	bytes, error := loadFile(ando, &errors)
+	if error {
+		return
 	}
-	if ando.transferFormat == F_HP64000ABS {
-		//TBD
+	knownRomType(ando)
+	bytes = prepareUploadImage(ando, bytes)
+	sendImage(ando, command, bytes, ando.offset, state)
+}
+
+// sendImage sends command and then image placed at address offset in current transfer format to EPrommer
+func sendImage(ando *AndoConnection, command string, bytes []byte, offset int, state ConnState) {
+	ando.uploadSums = computeChecksums(bytes, ando.sumStart, ando.sumLength)
+	printChecksums(ando.uploadSums)
+	if !checkUploadSize(ando, offset+len(bytes)) {
+		return
 	}
-	if ando.transferFormat == F_ASCIIHex {
-		uploadFileAsASCIIHex(ando, &errors)
+	checkUploadCoverage(ando, offset, len(bytes))
+	var data []byte
+	switch ando.transferFormat {
+	case F_ASCIIHex:
+		data = encodeASCIIHex(bytes, offset, currentFirmwareProfile(ando))
+	case F_HP64000ABS:
+		data = encodeHp64K(bytes, offset, currentFirmwareProfile(ando))
+	default:
+		logf(ando, "Sending data is not supported for current transfer format\n\r")
+		return
+	}
+	sendData(ando, command, data, state)
+}
+
+// sendData sends command and then data to EPrommer
+func sendData(ando *AndoConnection, command string, data []byte, state ConnState) {
+	logf(ando, "Upload buffer has size %v bytes. Please wait for upload to complete...\n\r", len(data))
+	ando.lastPassed = false
+	ando.lastReply = ""
+	ando.endCriteriaTest = 0
+	ando.failCriteriaCollecting = false
+	// device will need some time to process all data
+	// We need to wait for "[PASS]" answer
+	// only then, the final RESET '@' we like to send will be handled by device.
+	// If we do not wait, the Programmer stays in S-INPUT mode, and we have to enter RESET via device key "RESET"
+	// or send it via "Ando/Promac EPROM Programmer Communication UI" by using the '@' key
+	// So we go to new state and wait there for incoming "[PASS]" message
+	ando.state = state
+	sendKeys(ando, command)
+	// give some time to have command understood
+	time.Sleep(100 * time.Millisecond)
+
+	operation := "upload"
+	if state == VerifyData {
+		operation = "verify"
+	}
+	progress := newProgress(operation, len(data))
+	ando.progress = progress
+	if !ando.dryMode {
+		i := 0
+		b := make([]byte, 1)
+		for i < len(data) {
+			b[0] = data[i]
+			ando.serial.tty.Write(b)
+			i++
+			progress.done = i
+		}
 	}
+	progress.stop = time.Now()
 }
 
 // helpText print help text
@@ -362,8 +790,18 @@ func helpText(ando *AndoConnection) {
 	fmt.Print("Compound Commands:\n\r")
 	fmt.Print(" : q		- Quit Ando/Promac EPROM Programmer Communication UI\n\r")
 	fmt.Print(" : d		- Download EPROM data (like U7)\n\r")
+	fmt.Printf(" : c		- Compare downloaded EPROM data with reference file %v\n\r", ando.referenceFile)
 	fmt.Printf(" : w		- Write EPROM data to file %v-<checksum>.bin\n\r", ando.downloadFile)
 	fmt.Printf(" : u		- Upload EPROM data from file %v to EPrommer\n\r", ando.uploadFile)
+	fmt.Printf(" : v		- Verify EPrommer RAM buffer against file %v on device (like U8)\n\r", ando.uploadFile)
+	fmt.Print(" : e		- Edit downloaded EPROM data in hex editor\n\r")
+	fmt.Print(" : x		- Show differences between a file and downloaded EPROM data\n\r")
+	fmt.Printf(" : b		- Burn file %v: blank check, upload, program and verify\n\r", ando.uploadFile)
+	fmt.Printf(" : p		- Check whether file %v can be programmed over chip contents (erase or patch-burn)\n\r", ando.uploadFile)
+	fmt.Printf(" : t		- Select ROM type (e.g. 2764), currently: %v\n\r", romTypeName(ando))
+	fmt.Print(" : l		- Switch between line mode (edit line, send on Enter) and single keys\n\r")
+	fmt.Print(" : n		- Enter a named command (blank, program, verify, copy, format hp64k, romtype, reset, help)\n\r")
+	fmt.Print(" : s		- Run script file\n\r")
 	fmt.Printf(" : f		- Change file transfer format (ASCII-Hex, HP64000ABS, GENERIC). Current is: ")
 	switch ando.transferFormat {
 	case F_GENERIC:
@@ -380,31 +818,34 @@ func helpText(ando *AndoConnection) {
 }
 
 // writeDataToFile writes data from AndoConnection.lineInfos to AndoConnection.downloadFile,
-// data is written to EPrommer's RAM buffer
+// data is written to EPrommer's RAM buffer. Only range --start/--length is written, at file address --offset.
 func writeDataToFile(ando *AndoConnection) {
-	numBytes := 0
-	sb := new(strings.Builder)
-	// Convert codes to byte stream
-	for _, line := range ando.lineInfos {
-		for i, code := range line.codes {
-			if i < 16 {
-				sb.WriteByte(code)
-				numBytes++
-			}
-		}
+	data := downloadedImage(ando)
+	if ando.trim {
+		data = trimImage(data, ando.fill)
 	}
+	bytes := placeBytes(nil, uint32(ando.offset), data)
+	numBytes := len(bytes)
 	// Write file
-	filename := createFileName(ando.downloadFile, ando.checksum)
-	err := os.WriteFile(filename, []byte(sb.String()), 0644)
+	filename := createFileName(ando.downloadFile, ando.identified, ando.checksum)
+	err := os.WriteFile(filename, bytes, 0644)
 	if err != nil {
-		log.Printf("Error Writing file %s\n\r", err)
+		logf(ando, "Error Writing file %s\n\r", err)
 		return
 	}
-	log.Printf("\n\rWrote %v bytes to file\n\r", numBytes)
+	logf(ando, "\n\rWrote %v bytes to file\n\r", numBytes)
+	archiveDump(ando, filename, len(data))
+	if ando.lanes > 1 {
+		writeLaneToFile(ando)
+	}
 }
 
-func createFileName(file string, checksum uint32) string {
+// createFileName creates file name from checksum and name of known ROM image (if identified)
+func createFileName(file string, identified string, checksum uint32) string {
 	fname := fmt.Sprintf("%v-%06x.bin", file, checksum)
+	if identified != "" {
+		fname = fmt.Sprintf("%v-%v-%06x.bin", file, catalogFileName(identified), checksum)
+	}
 	log.Printf("Created file name: %v", fname)
 	return fname
 }
@@ -413,12 +854,12 @@ func createFileName(file string, checksum uint32) string {
 // Returns a byte array and true on error, false if loading was successful
 func loadFile(ando *AndoConnection, errors *int) ([]byte, bool) {
 	// Read in file
-	bytes, err := os.ReadFile(ando.uploadFile)
+	bytes, err := loadImage(ando.uploadFile)
 	if err != nil {
-		log.Printf("Error loading input file %s: %s\n\r", ando.uploadFile, err)
+		logf(ando, "Error loading input file %s: %s\n\r", ando.uploadFile, err)
 		*errors++
 		return nil, true
 	}
-	log.Printf("Loaded input file %s, %v bytes\n", ando.uploadFile, len(bytes))
+	logf(ando, "Loaded input file %s, %v bytes\n", ando.uploadFile, len(bytes))
 	return bytes, false
 }
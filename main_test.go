@@ -0,0 +1,49 @@
+package main
+
+import "testing"
+
+func TestParseReplyAddress(t *testing.T) {
+	tests := []struct {
+		message string
+		address uint32
+		found   bool
+	}{
+		{"FAIL 00001A2F", 0x1a2f, true},
+		{"VERIFY ERR,ADDR=0FF0", 0xff0, true},
+		{"FAIL", 0, false},
+		{"ERR 12", 0, false},
+		{"FAIL 123456789", 0, false},
+	}
+	for _, test := range tests {
+		address, found := parseReplyAddress(test.message)
+		if address != test.address || found != test.found {
+			t.Errorf("parseReplyAddress(%q) = %x, %v, want %x, %v", test.message, address, found, test.address, test.found)
+		}
+	}
+}
+
+func TestFailCriteriaCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		chunks  []string
+		failed  bool
+		message string
+	}{
+		{"pass", []string{"[PASS]"}, false, ""},
+		{"fail", []string{"[FAIL]"}, true, "FAIL"},
+		{"split over chunks", []string{"[FA", "IL 0", "0FF]"}, true, "FAIL 00FF"},
+		{"pass before fail", []string{"[PASS][ERR]"}, true, "ERR"},
+	}
+	for _, test := range tests {
+		ando := &AndoConnection{}
+		failed, message := false, ""
+		for _, chunk := range test.chunks {
+			if found, text := failCriteriaCheck(ando, []byte(chunk)); found {
+				failed, message = true, text
+			}
+		}
+		if failed != test.failed || message != test.message {
+			t.Errorf("%v: %v %q, want %v %q", test.name, failed, message, test.failed, test.message)
+		}
+	}
+}
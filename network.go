@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Besides local TTY devices the EPrommer can be reached over network, e.g. when it is attached to a
+// small Linux box in the lab:
+//   tcp://host:port      raw TCP connection (ser2net 'raw' mode, socat)
+//   rfc2217://host:port  Telnet with COM-PORT-OPTION (RFC 2217, ser2net 'telnet' mode), serial port
+//                        settings (baud rate, 8N1, flow control) are negotiated with the server
+
+// Telnet commands and options, see RFC 854, RFC 856, RFC 858 and RFC 2217
+const (
+	telnetSE   = 240
+	telnetSB   = 250
+	telnetWILL = 251
+	telnetWONT = 252
+	telnetDO   = 253
+	telnetDONT = 254
+	telnetIAC  = 255
+
+	telnetOptBinary   = 0
+	telnetOptSGA      = 3
+	telnetOptComPort  = 44
+	comPortSetBaud    = 1
+	comPortSetData    = 2
+	comPortSetParity  = 3
+	comPortSetStop    = 4
+	comPortSetControl = 5
+	comPortServerBase = 100 // server answers with command + 100
+
+	comPortParityNone   = 1
+	comPortStopOne      = 1
+	comPortFlowHardware = 3 // RTS/CTS, like the local TTY is configured
+)
+
+// comPortConfirmTimeout is the time RFC 2217 server gets to confirm serial port settings
+var comPortConfirmTimeout = 5 * time.Second
+
+// isNetworkDevice returns true if device is a tcp:// or rfc2217:// URL
+func isNetworkDevice(device string) bool {
+	return strings.HasPrefix(device, "tcp://") || strings.HasPrefix(device, "rfc2217://")
+}
+
+// openNetwork opens network connection to device given as tcp:// or rfc2217:// URL
+func (ando *AndoSerialConnection) openNetwork() error {
+	deviceURL, err := url.Parse(ando.device)
+	if err != nil {
+		return err
+	}
+	if deviceURL.Port() == "" {
+		return fmt.Errorf("no port given in %v", ando.device)
+	}
+	conn, err := net.DialTimeout("tcp", deviceURL.Host, 10*time.Second)
+	if err != nil {
+		return err
+	}
+	if deviceURL.Scheme == "tcp" {
+		ando.tty = conn
+		return nil
+	}
+	telnet := newTelnetConnection(conn)
+	err = telnet.negotiateComPort(ando.baudrate)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	ando.tty = telnet
+	return nil
+}
+
+// TelnetConnection Telnet connection with RFC 2217 COM-PORT-OPTION, data is passed transparently
+// (IAC is escaped), Telnet commands are handled while reading
+type TelnetConnection struct {
+	conn     net.Conn
+	reader   *bufio.Reader
+	mutex    sync.Mutex   // serializes writes of data and of Telnet negotiation
+	answered map[int]bool // options already answered, avoids negotiation loops
+	baudrate int          // baud rate confirmed by server, 0 if not confirmed yet
+	control  int          // flow control confirmed by server, 0 if not confirmed yet
+}
+
+func newTelnetConnection(conn net.Conn) *TelnetConnection {
+	return &TelnetConnection{
+		conn:     conn,
+		reader:   bufio.NewReader(conn),
+		answered: make(map[int]bool),
+	}
+}
+
+// negotiateComPort offers COM-PORT-OPTION and sets serial port of server to baudrate, 8N1 and
+// hardware flow control. Waits up to comPortConfirmTimeout for server to confirm baud rate and flow control,
+// settings not confirmed by then are logged as warning and the connection is used anyway.
+func (telnet *TelnetConnection) negotiateComPort(baudrate int) error {
+	baud := make([]byte, 4)
+	binary.BigEndian.PutUint32(baud, uint32(baudrate))
+	telnet.sendCommand(telnetWILL, telnetOptComPort)
+	telnet.sendCommand(telnetWILL, telnetOptBinary)
+	telnet.sendCommand(telnetDO, telnetOptBinary)
+	telnet.sendCommand(telnetDO, telnetOptSGA)
+	telnet.sendComPort(comPortSetBaud, baud...)
+	telnet.sendComPort(comPortSetData, 8)
+	telnet.sendComPort(comPortSetParity, comPortParityNone)
+	telnet.sendComPort(comPortSetStop, comPortStopOne)
+	telnet.sendComPort(comPortSetControl, comPortFlowHardware)
+
+	telnet.conn.SetReadDeadline(time.Now().Add(comPortConfirmTimeout))
+	defer telnet.conn.SetReadDeadline(time.Time{})
+	for telnet.baudrate == 0 || telnet.control == 0 {
+		b, err := telnet.reader.ReadByte()
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			if telnet.baudrate == 0 {
+				log.Printf("Warning: RFC 2217 server did not confirm baud rate %v within %v\n\r", baudrate,
+					comPortConfirmTimeout)
+			}
+			if telnet.control == 0 {
+				log.Printf("Warning: RFC 2217 server did not confirm hardware flow control within %v\n\r",
+					comPortConfirmTimeout)
+			}
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("RFC 2217 server did not confirm serial port settings: %v", err)
+		}
+		if b == telnetIAC {
+			_, err = telnet.handleCommand()
+			if err != nil {
+				return err
+			}
+		} else {
+			// no data expected before port is set up
+			telnet.reader.UnreadByte()
+			break
+		}
+	}
+	// 0 means not confirmed (yet), e.g. when server sends data first
+	if telnet.baudrate != 0 && telnet.baudrate != baudrate {
+		log.Printf("Warning: RFC 2217 server set baud rate %v instead of %v\n\r", telnet.baudrate, baudrate)
+	}
+	if telnet.control != 0 && telnet.control != comPortFlowHardware {
+		log.Printf("Warning: RFC 2217 server set flow control %v instead of hardware (RTS/CTS)\n\r", telnet.control)
+	}
+	return nil
+}
+
+// Read reads data, Telnet commands are handled and removed from data
+func (telnet *TelnetConnection) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if n > 0 && telnet.reader.Buffered() == 0 {
+			// return what we have instead of blocking
+			break
+		}
+		b, err := telnet.reader.ReadByte()
+		if err != nil {
+			return n, err
+		}
+		if b == telnetIAC {
+			data, err := telnet.handleCommand()
+			if err != nil {
+				return n, err
+			}
+			if !data {
+				continue
+			}
+		}
+		p[n] = b
+		n++
+	}
+	return n, nil
+}
+
+// handleCommand handles Telnet command after IAC. Returns true if IAC was an escaped 0xff data byte.
+func (telnet *TelnetConnection) handleCommand() (bool, error) {
+	command, err := telnet.reader.ReadByte()
+	if err != nil {
+		return false, err
+	}
+	switch command {
+	case telnetIAC:
+		return true, nil
+	case telnetWILL, telnetWONT, telnetDO, telnetDONT:
+		option, err := telnet.reader.ReadByte()
+		if err != nil {
+			return false, err
+		}
+		telnet.answerOption(int(command), int(option))
+	case telnetSB:
+		var sub []byte
+		for {
+			b, err := telnet.reader.ReadByte()
+			if err != nil {
+				return false, err
+			}
+			if b == telnetIAC {
+				b, err = telnet.reader.ReadByte()
+				if err != nil {
+					return false, err
+				}
+				if b == telnetSE {
+					break
+				}
+			}
+			sub = append(sub, b)
+		}
+		telnet.handleSubnegotiation(sub)
+	}
+	// other commands (NOP, GA, ...) are ignored
+	return false, nil
+}
+
+// answerOption answers option negotiation of server. Binary, SGA and COM-PORT-OPTION are accepted,
+// all other options are refused.
+func (telnet *TelnetConnection) answerOption(command int, option int) {
+	key := command<<8 | option
+	if telnet.answered[key] {
+		return
+	}
+	telnet.answered[key] = true
+	accepted := option == telnetOptBinary || option == telnetOptSGA || option == telnetOptComPort
+	switch command {
+	case telnetDO:
+		if option == telnetOptComPort {
+			// already offered
+			return
+		}
+		if accepted {
+			telnet.sendCommand(telnetWILL, byte(option))
+		} else {
+			telnet.sendCommand(telnetWONT, byte(option))
+		}
+	case telnetWILL:
+		if option == telnetOptBinary || option == telnetOptSGA {
+			// already requested
+			return
+		}
+		telnet.sendCommand(telnetDONT, byte(option))
+	}
+}
+
+// handleSubnegotiation handles answers of server to COM-PORT-OPTION commands
+func (telnet *TelnetConnection) handleSubnegotiation(sub []byte) {
+	if len(sub) < 2 || sub[0] != telnetOptComPort {
+		return
+	}
+	switch int(sub[1]) {
+	case comPortServerBase + comPortSetBaud:
+		if len(sub) >= 6 {
+			telnet.baudrate = int(binary.BigEndian.Uint32(sub[2:6]))
+		}
+	case comPortServerBase + comPortSetControl:
+		if len(sub) >= 3 && sub[2] >= 1 && sub[2] <= 3 {
+			// only outbound flow control settings are confirmed here, inbound settings (13-16) are not used
+			telnet.control = int(sub[2])
+		}
+	}
+}
+
+// Write writes data, 0xff bytes are escaped as IAC IAC
+func (telnet *TelnetConnection) Write(p []byte) (int, error) {
+	data := make([]byte, 0, len(p))
+	for _, b := range p {
+		data = append(data, b)
+		if b == telnetIAC {
+			data = append(data, telnetIAC)
+		}
+	}
+	telnet.mutex.Lock()
+	defer telnet.mutex.Unlock()
+	_, err := telnet.conn.Write(data)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close closes network connection
+func (telnet *TelnetConnection) Close() error {
+	return telnet.conn.Close()
+}
+
+// sendCommand sends Telnet option negotiation
+func (telnet *TelnetConnection) sendCommand(command byte, option byte) {
+	telnet.mutex.Lock()
+	defer telnet.mutex.Unlock()
+	telnet.conn.Write([]byte{telnetIAC, command, option})
+}
+
+// sendComPort sends COM-PORT-OPTION subnegotiation, IAC in values is escaped
+func (telnet *TelnetConnection) sendComPort(command byte, values ...byte) {
+	data := []byte{telnetIAC, telnetSB, telnetOptComPort, command}
+	for _, b := range values {
+		data = append(data, b)
+		if b == telnetIAC {
+			data = append(data, telnetIAC)
+		}
+	}
+	data = append(data, telnetIAC, telnetSE)
+	telnet.mutex.Lock()
+	defer telnet.mutex.Unlock()
+	telnet.conn.Write(data)
+}
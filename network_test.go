@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeComPortServer accepts one connection on a loopback port, sends reply and returns everything the
+// client sent until the client closes the connection
+func fakeComPortServer(t *testing.T, reply []byte) (string, <-chan []byte) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := make(chan []byte, 1)
+	go func() {
+		defer listener.Close()
+		conn, err := listener.Accept()
+		if err != nil {
+			received <- nil
+			return
+		}
+		defer conn.Close()
+		conn.Write(reply)
+		data, _ := io.ReadAll(conn)
+		received <- data
+	}()
+	return listener.Addr().String(), received
+}
+
+// comPortReply returns server answer to COM-PORT-OPTION command
+func comPortReply(command byte, values ...byte) []byte {
+	data := []byte{telnetIAC, telnetSB, telnetOptComPort, comPortServerBase + command}
+	for _, b := range values {
+		data = append(data, b)
+		if b == telnetIAC {
+			data = append(data, telnetIAC)
+		}
+	}
+	return append(data, telnetIAC, telnetSE)
+}
+
+func baudValue(baudrate int) []byte {
+	baud := make([]byte, 4)
+	binary.BigEndian.PutUint32(baud, uint32(baudrate))
+	return baud
+}
+
+func TestNegotiateComPort(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	tests := []struct {
+		name     string
+		reply    []byte
+		baudrate int
+		control  int
+		warning  bool
+	}{
+		{"confirmed", append(comPortReply(comPortSetBaud, baudValue(19200)...),
+			comPortReply(comPortSetControl, comPortFlowHardware)...), 19200, comPortFlowHardware, false},
+		{"other baud rate", append(comPortReply(comPortSetBaud, baudValue(9600)...),
+			comPortReply(comPortSetControl, comPortFlowHardware)...), 9600, comPortFlowHardware, true},
+		{"other flow control", append(comPortReply(comPortSetBaud, baudValue(19200)...),
+			comPortReply(comPortSetControl, 1)...), 19200, 1, true},
+		{"data before confirmation", []byte("R"), 0, 0, false},
+		{"baud rate only", append(comPortReply(comPortSetBaud, baudValue(19200)...), 'R'), 19200, 0, false},
+	}
+	for _, test := range tests {
+		buf.Reset()
+		address, received := fakeComPortServer(t, test.reply)
+		conn, err := net.DialTimeout("tcp", address, time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		telnet := newTelnetConnection(conn)
+		err = telnet.negotiateComPort(19200)
+		if err != nil {
+			t.Errorf("%v: negotiateComPort() = %v", test.name, err)
+		}
+		if telnet.baudrate != test.baudrate || telnet.control != test.control {
+			t.Errorf("%v: confirmed baud rate %v, flow control %v, want %v, %v", test.name, telnet.baudrate,
+				telnet.control, test.baudrate, test.control)
+		}
+		if warning := bytes.Contains(buf.Bytes(), []byte("Warning")); warning != test.warning {
+			t.Errorf("%v: logged %q, warning expected %v", test.name, buf.String(), test.warning)
+		}
+		telnet.Close()
+		sent := <-received
+		setBaud := []byte{telnetIAC, telnetSB, telnetOptComPort, comPortSetBaud, 0, 0, 0x4b, 0, telnetIAC, telnetSE}
+		if !bytes.Contains(sent, setBaud) {
+			t.Errorf("%v: client sent % x, no SET-BAUDRATE 19200", test.name, sent)
+		}
+	}
+}
+
+// TestNegotiateComPortTimeout lets server confirm baud rate only and then stay silent, the connection
+// is used anyway with a warning for flow control
+func TestNegotiateComPortTimeout(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	saved := comPortConfirmTimeout
+	defer func() { comPortConfirmTimeout = saved }()
+	comPortConfirmTimeout = 200 * time.Millisecond
+
+	address, received := fakeComPortServer(t, comPortReply(comPortSetBaud, baudValue(19200)...))
+	conn, err := net.DialTimeout("tcp", address, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	telnet := newTelnetConnection(conn)
+	if err := telnet.negotiateComPort(19200); err != nil {
+		t.Errorf("negotiateComPort() = %v", err)
+	}
+	if telnet.baudrate != 19200 || telnet.control != 0 {
+		t.Errorf("confirmed baud rate %v, flow control %v", telnet.baudrate, telnet.control)
+	}
+	if !strings.Contains(buf.String(), "did not confirm hardware flow control") ||
+		strings.Contains(buf.String(), "did not confirm baud rate") {
+		t.Errorf("logged %q", buf.String())
+	}
+	// connection is still usable after timeout
+	if _, err := telnet.Write([]byte("R ")); err != nil {
+		t.Errorf("Write() = %v", err)
+	}
+	telnet.Close()
+	if sent := <-received; !bytes.HasSuffix(sent, []byte("R ")) {
+		t.Errorf("client sent % x", sent)
+	}
+}
+
+func TestTelnetEscaping(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		wire []byte
+	}{
+		{"plain", []byte{0x00, 0x41, 0xfe}, []byte{0x00, 0x41, 0xfe}},
+		{"single 0xff", []byte{0x01, 0xff, 0x02}, []byte{0x01, 0xff, 0xff, 0x02}},
+		{"repeated 0xff", []byte{0xff, 0xff}, []byte{0xff, 0xff, 0xff, 0xff}},
+	}
+	for _, test := range tests {
+		// server echoes escaped data followed by NOP, which is removed while reading
+		address, received := fakeComPortServer(t, append(append([]byte{}, test.wire...), telnetIAC, 241))
+		conn, err := net.DialTimeout("tcp", address, time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		telnet := newTelnetConnection(conn)
+		n, err := telnet.Write(test.data)
+		if n != len(test.data) || err != nil {
+			t.Errorf("%v: Write() = %v, %v", test.name, n, err)
+		}
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		var data []byte
+		p := make([]byte, 16)
+		for len(data) < len(test.data) {
+			n, err := telnet.Read(p)
+			if err != nil {
+				t.Errorf("%v: Read() = %v", test.name, err)
+				break
+			}
+			data = append(data, p[:n]...)
+		}
+		if !bytes.Equal(data, test.data) {
+			t.Errorf("%v: read % x, want % x", test.name, data, test.data)
+		}
+		telnet.Close()
+		if sent := <-received; !bytes.Equal(sent, test.wire) {
+			t.Errorf("%v: client sent % x, want % x", test.name, sent, test.wire)
+		}
+	}
+}
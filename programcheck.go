@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+)
+
+// EPROM programming can only change bits from 1 to 0, only erasing (UV) sets them back to 1.
+// Before DEVICE-PROGRAM the chip contents are compared with the image to find out whether the
+// chip must be erased first or the image can be burned over the current contents (patch-burn).
+
+// ProgramCheck result of comparing chip contents with image to be programmed
+type ProgramCheck struct {
+	size           int        // number of bytes checked
+	blank          bool       // chip is erased (all 0xff) in checked range
+	identical      bool       // chip already holds image
+	bytesToProgram int        // bytes with bits to change from 1 to 0
+	conflicts      int        // bytes with bits to change from 0 to 1 (erase required)
+	diffs          []ByteDiff // first conflicting bytes (expected: image, actual: chip)
+}
+
+// eraseRequired returns true if image cannot be programmed without erasing the chip first
+func (check *ProgramCheck) eraseRequired() bool {
+	return check.conflicts > 0
+}
+
+// checkProgrammability compares chip contents with image. Only bits 0 in chip and 1 in image are a
+// problem, they cannot be programmed. Only the first maxDiffs conflicts are recorded in detail.
+func checkProgrammability(chip []byte, image []byte, maxDiffs int) ProgramCheck {
+	check := ProgramCheck{size: len(image), blank: true}
+	for i, b := range image {
+		c := byte(0xff)
+		if i < len(chip) {
+			c = chip[i]
+		}
+		if c != 0xff {
+			check.blank = false
+		}
+		if b == c {
+			continue
+		}
+		check.bytesToProgram++
+		if b&^c != 0 {
+			check.conflicts++
+			if len(check.diffs) < maxDiffs {
+				check.diffs = append(check.diffs, ByteDiff{uint32(i), b, c})
+			}
+		}
+	}
+	check.identical = check.bytesToProgram == 0
+	return check
+}
+
+// printProgramCheck pretty print result of a programmability check, address offset is added to all addresses
+func printProgramCheck(ando *AndoConnection, check ProgramCheck, offset int) {
+	switch {
+	case check.identical:
+		logf(ando, "Chip already holds image (%v bytes), nothing to program\n\r", check.size)
+	case check.blank:
+		logf(ando, "Chip is blank, image can be programmed (%v bytes)\n\r", check.bytesToProgram)
+	case !check.eraseRequired():
+		logf(ando, "Chip is not blank, but image only clears bits: patch-burn possible, %v bytes to program\n\r",
+			check.bytesToProgram)
+	default:
+		fmt.Printf("Address  Image    Chip\n\r")
+		for _, diff := range check.diffs {
+			fmt.Printf("%08x %02x       %02x\n\r", int(diff.address)+offset, diff.expected, diff.actual)
+		}
+		if check.conflicts > len(check.diffs) {
+			fmt.Printf("... %v more\n\r", check.conflicts-len(check.diffs))
+		}
+		logf(ando, "Erase required: %v bytes need bits changed from 0 to 1\n\r", check.conflicts)
+	}
+}
+
+// programCheck copies socket contents into RAM buffer (DEVICE-COPY), downloads them and checks whether
+// upload image can be programmed over them. Returns result and false if check could not be executed.
+// Note: RAM buffer holds chip contents afterwards, image must be uploaded again before DEVICE-PROGRAM.
+func programCheck(ando *AndoConnection) (ProgramCheck, bool) {
+	errors := 0
+	image, error := loadFile(ando, &errors)
+	if error {
+		return ProgramCheck{}, false
+	}
+	image = prepareUploadImage(ando, image)
+	logf(ando, "Copying chip contents to check whether %v can be programmed\n\r", ando.uploadFile)
+	if !deviceCommand(ando, "PA\r") {
+		logf(ando, "DEVICE-COPY failed\n\r")
+		return ProgramCheck{}, false
+	}
+	if !downloadImage(ando) {
+		return ProgramCheck{}, false
+	}
+	chip := imageFromLineInfos(ando.lineInfos)
+	check := checkProgrammability(sliceRange(chip, ando.offset, len(image)), image, ando.maxDiffs)
+	printProgramCheck(ando, check, ando.offset)
+	return check, true
+}
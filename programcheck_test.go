@@ -0,0 +1,48 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCheckProgrammability(t *testing.T) {
+	tests := []struct {
+		name           string
+		chip           []byte
+		image          []byte
+		blank          bool
+		identical      bool
+		bytesToProgram int
+		conflicts      int
+		diffs          []ByteDiff
+	}{
+		{"blank chip", []byte{0xff, 0xff}, []byte{0x12, 0x34}, true, false, 2, 0, nil},
+		{"identical", []byte{0x12, 0x34}, []byte{0x12, 0x34}, false, true, 0, 0, nil},
+		{"patch-burn", []byte{0xff, 0xf0}, []byte{0x12, 0x30}, false, false, 2, 0, nil},
+		{"erase required", []byte{0x00, 0x34}, []byte{0x01, 0x34}, false, false, 1, 1, []ByteDiff{{0, 0x01, 0x00}}},
+		{"chip shorter than image", []byte{0x12}, []byte{0x12, 0x55}, false, false, 1, 0, nil},
+	}
+	for _, test := range tests {
+		check := checkProgrammability(test.chip, test.image, 10)
+		if check.blank != test.blank || check.identical != test.identical {
+			t.Errorf("%v: blank %v identical %v", test.name, check.blank, check.identical)
+		}
+		if check.bytesToProgram != test.bytesToProgram || check.conflicts != test.conflicts {
+			t.Errorf("%v: %v bytes to program, %v conflicts, want %v %v", test.name, check.bytesToProgram,
+				check.conflicts, test.bytesToProgram, test.conflicts)
+		}
+		if !reflect.DeepEqual(check.diffs, test.diffs) {
+			t.Errorf("%v: diffs %v, want %v", test.name, check.diffs, test.diffs)
+		}
+		if check.eraseRequired() != (test.conflicts > 0) {
+			t.Errorf("%v: eraseRequired() is %v", test.name, check.eraseRequired())
+		}
+	}
+}
+
+func TestCheckProgrammabilityMaxDiffs(t *testing.T) {
+	check := checkProgrammability(make([]byte, 10), []byte{1, 1, 1, 1, 1, 1, 1, 1, 1, 1}, 3)
+	if check.conflicts != 10 || len(check.diffs) != 3 {
+		t.Errorf("%v conflicts, %v diffs, want 10 and 3", check.conflicts, len(check.diffs))
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Progress of a transfer is counted in bytes sent to or received from EPrommer. The expected total of an
+// upload is the size of the encoded data, of a download it is estimated from ROM type and transfer format.
+
+// progressBarWidth number of chars of progress bar in line output
+const progressBarWidth = 20
+
+// Progress progress of a transfer
+type Progress struct {
+	operation string    // "download", "upload" or "verify"
+	done      int       // bytes transferred so far
+	total     int       // expected number of bytes, 0 if not known
+	start     time.Time // start of transfer
+	stop      time.Time // all data sent, zero while sending or receiving
+}
+
+// newProgress starts progress of a transfer
+func newProgress(operation string, total int) *Progress {
+	return &Progress{operation: operation, total: total, start: time.Now()}
+}
+
+// activeProgress returns progress of transfer running, nil if there is none
+func activeProgress(ando *AndoConnection) *Progress {
+	if ando.state != ReceiveData && ando.state != SendData && ando.state != VerifyData {
+		return nil
+	}
+	return ando.progress
+}
+
+// expectedDownloadSize returns expected number of bytes of a download of ROM type in current transfer
+// format, 0 if ROM type is not known. It is computed from the download framing of the firmware profile
+// and the examples in file-formats.md.
+func expectedDownloadSize(ando *AndoConnection) int {
+	if ando.romType == nil {
+		return 0
+	}
+	size := ando.romType.size
+	records := (size + 15) / 16
+	profile := currentFirmwareProfile(ando)
+	// CR LF lines and zeroes in header, zeroes and CR LF in footer
+	framing := profile.headerLines*2 + profile.headerZeroes + profile.footerZeroes + 2
+	switch ando.transferFormat {
+	case F_ASCIIHex:
+		// '[', records of "#AAAAAAAA," and "XX," per byte, each ending with CR LF
+		return framing + 1 + records*(10+2) + size*3
+	case F_HP64000ABS:
+		// Start-Of-File record, records of 7 bytes header, data and checksum, End-Of-File record
+		return 10 + records*(7+1) + size + 1
+	}
+	// data framed like ASCII-Hex
+	return framing + size
+}
+
+// rate returns throughput in bytes per second
+func (progress *Progress) rate() float64 {
+	end := progress.stop
+	if end.IsZero() {
+		end = time.Now()
+	}
+	seconds := end.Sub(progress.start).Seconds()
+	if seconds <= 0 {
+		return 0
+	}
+	return float64(progress.done) / seconds
+}
+
+// percent returns part of expected total done, -1 if total is not known
+func (progress *Progress) percent() int {
+	if progress.total <= 0 {
+		return -1
+	}
+	percent := progress.done * 100 / progress.total
+	if percent > 100 {
+		percent = 100
+	}
+	return percent
+}
+
+// eta returns estimated time until transfer is complete, -1 if not known
+func (progress *Progress) eta() time.Duration {
+	rate := progress.rate()
+	if progress.total <= 0 || rate <= 0 {
+		return -1
+	}
+	remaining := progress.total - progress.done
+	if remaining < 0 {
+		remaining = 0
+	}
+	return time.Duration(float64(remaining) / rate * float64(time.Second))
+}
+
+// bar returns progress bar of width chars, e.g. "#####-----"
+func (progress *Progress) bar(width int) string {
+	percent := progress.percent()
+	if percent < 0 {
+		percent = 0
+	}
+	done := percent * width / 100
+	return strings.Repeat("#", done) + strings.Repeat("-", width-done)
+}
+
+// String returns progress as text, e.g. "download 2048/8192 bytes (25%), 480 bytes/s, ETA 0:12"
+func (progress *Progress) String() string {
+	text := fmt.Sprintf("%v %v", progress.operation, progress.done)
+	if progress.total > 0 {
+		text += fmt.Sprintf("/%v bytes (%v%%)", progress.total, progress.percent())
+	} else {
+		text += " bytes"
+	}
+	text += fmt.Sprintf(", %.0f bytes/s", progress.rate())
+	if eta := progress.eta(); eta >= 0 {
+		seconds := int(eta.Round(time.Second).Seconds())
+		text += fmt.Sprintf(", ETA %d:%02d", seconds/60, seconds%60)
+	}
+	return text
+}
+
+// reportProgress prints a progress line every second while a transfer is running (batch mode)
+func reportProgress(ando *AndoConnection) {
+	var last *Progress
+	lastDone := -1
+	for running(ando) {
+		time.Sleep(time.Second)
+		progress := activeProgress(ando)
+		if progress == nil {
+			if last != nil {
+				fmt.Printf("\n\r%v finished, %v bytes transferred\n\r", last.operation, last.done)
+				last = nil
+			}
+			continue
+		}
+		if progress != last || progress.done != lastDone {
+			fmt.Printf("\n\r[%v] %v\n\r", progress.bar(progressBarWidth), progress)
+		}
+		last = progress
+		lastDone = progress.done
+	}
+}
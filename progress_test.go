@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"testing"
+	"time"
+)
+
+// finishedProgress returns progress of a transfer that took seconds
+func finishedProgress(done int, total int, seconds int) *Progress {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	return &Progress{operation: "download", done: done, total: total, start: start,
+		stop: start.Add(time.Duration(seconds) * time.Second)}
+}
+
+func TestProgress(t *testing.T) {
+	tests := []struct {
+		done    int
+		total   int
+		seconds int
+		rate    float64
+		percent int
+		eta     time.Duration
+		bar     string
+		text    string
+	}{
+		{2048, 8192, 4, 512, 25, 12 * time.Second, "##--------",
+			"download 2048/8192 bytes (25%), 512 bytes/s, ETA 0:12"},
+		{0, 8192, 4, 0, 0, -1, "----------", "download 0/8192 bytes (0%), 0 bytes/s"},
+		{1000, 0, 10, 100, -1, -1, "----------", "download 1000 bytes, 100 bytes/s"},
+		{9000, 8192, 10, 900, 100, 0, "##########", "download 9000/8192 bytes (100%), 900 bytes/s, ETA 0:00"},
+		{100, 65636, 1, 100, 0, 655360 * time.Millisecond, "----------",
+			"download 100/65636 bytes (0%), 100 bytes/s, ETA 10:55"},
+		{100, 200, 0, 0, 50, -1, "#####-----", "download 100/200 bytes (50%), 0 bytes/s"},
+	}
+	for _, test := range tests {
+		progress := finishedProgress(test.done, test.total, test.seconds)
+		if rate := progress.rate(); rate != test.rate {
+			t.Errorf("%v: rate() = %v, want %v", progress, rate, test.rate)
+		}
+		if percent := progress.percent(); percent != test.percent {
+			t.Errorf("%v: percent() = %v, want %v", progress, percent, test.percent)
+		}
+		if eta := progress.eta(); eta != test.eta {
+			t.Errorf("%v: eta() = %v, want %v", progress, eta, test.eta)
+		}
+		if bar := progress.bar(10); bar != test.bar {
+			t.Errorf("%v: bar(10) = %q, want %q", progress, bar, test.bar)
+		}
+		if text := progress.String(); text != test.text {
+			t.Errorf("String() = %q, want %q", text, test.text)
+		}
+	}
+}
+
+func TestActiveProgress(t *testing.T) {
+	tests := []struct {
+		state  ConnState
+		active bool
+	}{
+		{NormalInput, false},
+		{CommandInput, false},
+		{ReceiveData, true},
+		{SendData, true},
+		{VerifyData, true},
+		{DeviceCommand, false},
+	}
+	for _, test := range tests {
+		ando := &AndoConnection{state: test.state, progress: newProgress("upload", 100)}
+		if active := activeProgress(ando) != nil; active != test.active {
+			t.Errorf("activeProgress() in state %v = %v, want %v", test.state, active, test.active)
+		}
+	}
+}
+
+func TestExpectedDownloadSize(t *testing.T) {
+	tests := []struct {
+		romType string
+		format  TransferFormat
+		size    int
+	}{
+		{"", F_ASCIIHex, 0},
+		{"2716", F_ASCIIHex, 6 + 52 + 1 + 128*(10+16*3+2) + 99 + 2},
+		{"2732", F_ASCIIHex, 6 + 52 + 1 + 256*(10+16*3+2) + 99 + 2},
+		{"2716", F_HP64000ABS, 10 + 128*(7+16+1) + 1},
+		{"2716", F_GENERIC, 6 + 52 + 2048 + 99 + 2},
+		{"2764", F_GENERIC, 6 + 52 + 8192 + 99 + 2},
+	}
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	for _, test := range tests {
+		ando := &AndoConnection{romType: findRomType(test.romType), transferFormat: test.format}
+		if size := expectedDownloadSize(ando); size != test.size {
+			t.Errorf("expectedDownloadSize(%v, %v) = %v, want %v", test.romType, test.format, size, test.size)
+		}
+	}
+	if buf.Len() > 0 {
+		t.Errorf("expectedDownloadSize logged %q", buf.String())
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RomType an EPROM part supported by EPrommer
+type RomType struct {
+	name  string // part name
+	code  string // device code (hex digits) shown on 'R <SPACE>' and entered after ROM TYPE
+	size  int    // capacity in bytes
+	width int    // data width in bits
+	notes string // programming notes
+}
+
+// The device codes are taken from the part table in the EPrommer's firmware (roms/, IC11 high byte and
+// IC10 low byte interleaved, same codes in 21.7 and 21.9). Parts programmed alike share a code there, e.g.
+// 27256 and 27C256. The code of the Intel part is used, TI for 2532 and 2564, ST for 27C1001, AMD for
+// 27C1024 and Toshiba for TC571000D. A code reported by the EPrommer that is not in the table is logged.
+
+var romTypes = []RomType{
+	RomType{name: "2716", code: "00", size: 2 * 1024, width: 8, notes: "Vpp 25V, single supply type only (no TMS2716)"},
+	RomType{name: "2732", code: "09", size: 4 * 1024, width: 8, notes: "Vpp 25V"},
+	RomType{name: "2732A", code: "0A", size: 4 * 1024, width: 8, notes: "Vpp 21V"},
+	RomType{name: "2532", code: "0C", size: 4 * 1024, width: 8, notes: "Vpp 25V, TI pinout, not pin compatible with 2732"},
+	RomType{name: "2764", code: "12", size: 8 * 1024, width: 8, notes: "Vpp 21V"},
+	RomType{name: "2764A", code: "13", size: 8 * 1024, width: 8, notes: "Vpp 12.5V"},
+	RomType{name: "27C64", code: "13", size: 8 * 1024, width: 8, notes: "Vpp 12.5V"},
+	RomType{name: "2564", code: "15", size: 8 * 1024, width: 8, notes: "Vpp 25V, TI pinout, 28 pins"},
+	RomType{name: "27128", code: "25", size: 16 * 1024, width: 8, notes: "Vpp 21V"},
+	RomType{name: "27128A", code: "26", size: 16 * 1024, width: 8, notes: "Vpp 12.5V"},
+	RomType{name: "27C128", code: "2A", size: 16 * 1024, width: 8, notes: "Vpp 12.5V"},
+	RomType{name: "27256", code: "2C", size: 32 * 1024, width: 8, notes: "Vpp 12.5V (some early parts 21V)"},
+	RomType{name: "27C256", code: "2C", size: 32 * 1024, width: 8, notes: "Vpp 12.5V"},
+	RomType{name: "27512", code: "36", size: 64 * 1024, width: 8, notes: "Vpp 12.5V, OE/Vpp on pin 22"},
+	RomType{name: "27C512", code: "3A", size: 64 * 1024, width: 8, notes: "Vpp 12.5V, OE/Vpp on pin 22"},
+	RomType{name: "27C010", code: "44", size: 128 * 1024, width: 8, notes: "Vpp 12.5V, 32 pins"},
+	RomType{name: "27C1001", code: "CD", size: 128 * 1024, width: 8, notes: "Vpp 12.5V, 32 pins, same as 27C010"},
+	RomType{name: "TC571000D", code: "44", size: 128 * 1024, width: 8, notes: "Vpp 12.5V, 32 pins, Toshiba 27C010 type"},
+	RomType{name: "27C020", code: "68", size: 256 * 1024, width: 8, notes: "Vpp 12.5V, 32 pins"},
+	RomType{name: "27C040", code: "7F", size: 512 * 1024, width: 8, notes: "Vpp 12.5V, 32 pins"},
+	RomType{name: "27C1024", code: "3C", size: 128 * 1024, width: 16, notes: "Vpp 12.5V, 40 pins, 64K x 16"},
+}
+
+// findRomType returns ROM type with name (case-insensitive), nil if unknown
+func findRomType(name string) *RomType {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	for i, romType := range romTypes {
+		if romType.name == name {
+			return &romTypes[i]
+		}
+	}
+	return nil
+}
+
+// parseRomTypeCode extracts the device code from answer of EPrommer to 'R <SPACE>'. The code is the
+// last group of hex digits in answer (upper case). Returns false if there is none.
+func parseRomTypeCode(reply string) (string, bool) {
+	fields := strings.FieldsFunc(strings.ToUpper(reply), func(r rune) bool {
+		return !strings.ContainsRune("0123456789ABCDEF", r)
+	})
+	if len(fields) == 0 {
+		return "", false
+	}
+	return fields[len(fields)-1], true
+}
+
+// findRomTypeByCode returns ROM type with device code, nil if code is not in table.
+// Leading zeroes are not significant.
+func findRomTypeByCode(code string) *RomType {
+	if code == "" {
+		return nil
+	}
+	code = strings.TrimLeft(strings.ToUpper(code), "0")
+	for i, romType := range romTypes {
+		if strings.TrimLeft(romType.code, "0") == code {
+			return &romTypes[i]
+		}
+	}
+	return nil
+}
+
+// findRomTypeInReply returns ROM type whose name is contained in answer of EPrommer, e.g. "Am27C256".
+// The longest name wins, so "2764A" is not taken for "2764". Returns nil if no part name is found.
+func findRomTypeInReply(reply string) *RomType {
+	reply = strings.ToUpper(reply)
+	var found *RomType
+	for i, romType := range romTypes {
+		if strings.Contains(reply, romType.name) && (found == nil || len(romType.name) > len(found.name)) {
+			found = &romTypes[i]
+		}
+	}
+	return found
+}
+
+// updateRomType queries currently selected ROM type from EPrommer and stores its code in ando.romCode
+// and the part in ando.romType. A part name in the answer is taken first, as parts programmed alike
+// share a code, e.g. 27256 and 27C256. Returns EPrommer's answer.
+func updateRomType(ando *AndoConnection) string {
+	reply := queryRomType(ando)
+	if reply == "" {
+		return reply
+	}
+	ando.romQueried = true
+	if romType := findRomTypeInReply(reply); romType != nil {
+		ando.romType = romType
+		ando.romCode = romType.code
+		if ando.debug > 0 {
+			logf(ando, "ROM type is %v\n\r", ando.romType)
+		}
+		return reply
+	}
+	code, found := parseRomTypeCode(reply)
+	if !found {
+		logf(ando, "No ROM type code in answer '%v'\n\r", reply)
+		ando.romCode = ""
+		ando.romType = nil
+		return reply
+	}
+	ando.romCode = code
+	ando.romType = findRomTypeByCode(code)
+	if ando.romType == nil {
+		logf(ando, "ROM type code %v is not in ROM type table, sizes are not checked\n\r", code)
+	} else if ando.debug > 0 {
+		logf(ando, "ROM type is %v\n\r", ando.romType)
+	}
+	return reply
+}
+
+// knownRomType queries ROM type from EPrommer once per session, later calls use the answer kept.
+// updateRomType queries again on request.
+func knownRomType(ando *AndoConnection) *RomType {
+	if !ando.romQueried {
+		updateRomType(ando)
+	}
+	return ando.romType
+}
+
+// maxRomTypeSize returns capacity of largest ROM type in bytes
+func maxRomTypeSize() int {
+	size := 0
+	for _, romType := range romTypes {
+		size = max(size, romType.size)
+	}
+	return size
+}
+
+// checkUploadSize checks if an image fits into selected ROM type.
+// Returns false if the image is too large and upload must be refused.
+func checkUploadSize(ando *AndoConnection, size int) bool {
+	if ando.romType == nil {
+		return true
+	}
+	if size > ando.romType.size {
+		if ando.force {
+			logf(ando, "Warning: image has %v bytes, ROM type %v has only %v bytes\n\r", size, ando.romType.name, ando.romType.size)
+			return true
+		}
+		logf(ando, "Image has %v bytes, ROM type %v has only %v bytes. Upload refused (use --force to upload anyway)\n\r",
+			size, ando.romType.name, ando.romType.size)
+		return false
+	}
+	return true
+}
+
+// checkDownloadSize warns if number of bytes downloaded does not match selected ROM type
+func checkDownloadSize(ando *AndoConnection, size int) {
+	if ando.romType != nil && size != ando.romType.size {
+		logf(ando, "Warning: downloaded %v bytes, but ROM type %v has %v bytes\n\r", size, ando.romType.name, ando.romType.size)
+	}
+}
+
+// String returns a description of ROM type
+func (romType RomType) String() string {
+	return fmt.Sprintf("%v (%v bytes, %v bit, %v, device code %v)", romType.name, romType.size, romType.width, romType.notes, romType.code)
+}
+
+// selectRomType selects ROM type on EPrommer and confirms selection by querying it again.
+// ROM type is selected like on the keypad, by entering its device code: ROM TYPE <code> SET.
+// Parts sharing the device code are programmed alike, so the selection is confirmed by the code.
+func selectRomType(ando *AndoConnection, name string) bool {
+	romType := findRomType(name)
+	if romType == nil {
+		logf(ando, "Unknown ROM type '%v', known types are:\n\r", name)
+		for _, known := range romTypes {
+			fmt.Printf(" %v", known.name)
+		}
+		fmt.Printf("\n\r")
+		return false
+	}
+	logf(ando, "Selecting ROM type %v\n\r", romType)
+	keys, err := keypadKeys(append(append([]string{"ROMTYPE"}, strings.Split(romType.code, "")...), "SET")...)
+	if err != nil {
+		logf(ando, "Illegal device code of ROM type %v: %s\n\r", romType.name, err)
+		return false
+	}
+	if !sendKeys(ando, keys) {
+		return false
+	}
+	if ando.dryMode {
+		ando.romType = romType
+		ando.romCode = romType.code
+		return true
+	}
+	time.Sleep(500 * time.Millisecond)
+	reply := updateRomType(ando)
+	if ando.romCode != romType.code {
+		logf(ando, "Selecting ROM type %v failed, EPrommer answered '%v'\n\r", romType.name, reply)
+		return false
+	}
+	ando.romType = romType
+	logf(ando, "ROM type %v selected\n\r", romType.name)
+	return true
+}
+
+// romTypeName returns name of ROM type selected on EPrommer, its code if the part is not in the table,
+// "unknown" if it was not queried
+func romTypeName(ando *AndoConnection) string {
+	if ando.romType != nil {
+		return ando.romType.name
+	}
+	if ando.romCode != "" {
+		return "code " + ando.romCode
+	}
+	return "unknown"
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeTTY records keys written and answers them like an EPrommer would, answer returns output for keys
+type fakeTTY struct {
+	ando    *AndoConnection
+	written strings.Builder
+	answer  func(keys string) string
+}
+
+func (tty *fakeTTY) Read(p []byte) (int, error) { return 0, nil }
+func (tty *fakeTTY) Close() error               { return nil }
+
+func (tty *fakeTTY) Write(p []byte) (int, error) {
+	tty.written.Write(p)
+	if tty.answer != nil {
+		captureConsole(tty.ando, []byte(tty.answer(string(p))))
+	}
+	return len(p), nil
+}
+
+// newFakeSession returns a session connected to a fakeTTY
+func newFakeSession(answer func(keys string) string) (*AndoConnection, *fakeTTY) {
+	ando := &AndoConnection{continueLoop: newContinueLoop(), consoleLock: &sync.Mutex{}}
+	tty := &fakeTTY{ando: ando, answer: answer}
+	ando.serial = &AndoSerialConnection{tty: tty, device: "fake", timeout: time.Second}
+	return ando, tty
+}
+
+func TestParseRomTypeCode(t *testing.T) {
+	tests := []struct {
+		reply string
+		code  string
+		found bool
+	}{
+		{"0A", "0A", true},
+		{"R 3f\r\n", "3F", true},
+		{"ROM TYPE: 12 ", "12", true},
+		{"R\r\n", "", false},
+		{"", "", false},
+	}
+	for _, test := range tests {
+		code, found := parseRomTypeCode(test.reply)
+		if code != test.code || found != test.found {
+			t.Errorf("parseRomTypeCode(%q) = %q, %v, want %q, %v", test.reply, code, found, test.code, test.found)
+		}
+	}
+}
+
+func TestFindRomTypeByCode(t *testing.T) {
+	tests := []struct {
+		code string
+		name string
+	}{
+		{"12", "2764"},
+		{"0a", "2732A"},
+		{"002C", "27256"},
+		{"00", "2716"},
+		{"0", "2716"},
+		{"7E", ""},
+		{"", ""},
+	}
+	for _, test := range tests {
+		romType := findRomTypeByCode(test.code)
+		name := ""
+		if romType != nil {
+			name = romType.name
+		}
+		if name != test.name {
+			t.Errorf("findRomTypeByCode(%q) = %q, want %q", test.code, name, test.name)
+		}
+	}
+}
+
+func TestFindRomType(t *testing.T) {
+	if romType := findRomType(" 27c256 "); romType == nil || romType.size != 32*1024 {
+		t.Errorf("findRomType(27c256) = %v", romType)
+	}
+	if romType := findRomType("2765"); romType != nil {
+		t.Errorf("findRomType(2765) = %v", romType)
+	}
+}
+
+func TestFindRomTypeInReply(t *testing.T) {
+	tests := []struct {
+		reply string
+		name  string
+	}{
+		{"Am27C256", "27C256"},
+		{"ROM TYPE Am2764A\r\n", "2764A"},
+		{"TMS2532", "2532"},
+		{"AT27C040 7D", "27C040"},
+		{"R 2C\r\n", ""},
+		{"", ""},
+	}
+	for _, test := range tests {
+		romType := findRomTypeInReply(test.reply)
+		name := ""
+		if romType != nil {
+			name = romType.name
+		}
+		if name != test.name {
+			t.Errorf("findRomTypeInReply(%q) = %q, want %q", test.reply, name, test.name)
+		}
+	}
+}
+
+func TestKnownRomTypeQueriesOnce(t *testing.T) {
+	ando, tty := newFakeSession(func(keys string) string { return "R 12\r\n" })
+	if romType := knownRomType(ando); romType == nil || romType.name != "2764" {
+		t.Fatalf("knownRomType = %v", romType)
+	}
+	knownRomType(ando)
+	if tty.written.String() != "R " {
+		t.Errorf("keys sent %q, want one query", tty.written.String())
+	}
+	if romTypeName(ando) != "2764" {
+		t.Errorf("romTypeName = %v", romTypeName(ando))
+	}
+}
+
+func TestUpdateRomTypeUnknownCode(t *testing.T) {
+	ando, _ := newFakeSession(func(keys string) string { return "R 7E\r\n" })
+	updateRomType(ando)
+	if ando.romType != nil || ando.romCode != "7E" || romTypeName(ando) != "code 7E" {
+		t.Errorf("romType %v, code %q, name %v", ando.romType, ando.romCode, romTypeName(ando))
+	}
+}
+
+// TestUploadSizeFromRomTypeReply resolves the answer to 'R <SPACE>' and uploads an image one byte
+// larger than the part
+func TestUploadSizeFromRomTypeReply(t *testing.T) {
+	tests := []struct {
+		reply string
+		name  string
+	}{
+		{"R 12\r\n", "2764"},
+		{"R 2C\r\n", "27256"},
+		{"ROM TYPE 2C Am27C256\r\n", "27C256"},
+		{"R 7f\r\n", "27C040"},
+	}
+	for _, test := range tests {
+		ando, tty := newFakeSession(func(keys string) string {
+			if keys == "R " {
+				return test.reply
+			}
+			return ""
+		})
+		ando.rangeLength = -1
+		ando.sumLength = -1
+		romType := findRomType(test.name)
+		ando.uploadFile = filepath.Join(t.TempDir(), "big.bin")
+		os.WriteFile(ando.uploadFile, make([]byte, romType.size+1), 0644)
+		uploadFile(ando)
+		if ando.romType != romType {
+			t.Errorf("reply %q resolved to %v, want %v", test.reply, romTypeName(ando), test.name)
+		}
+		if keys := tty.written.String(); keys != "R " {
+			t.Errorf("reply %q: oversized image was not refused, sent %q", test.reply, keys)
+		}
+	}
+}
+
+// TestUploadCoverageFromRomTypeReply uploads an image smaller than the part resolved from the answer
+// to 'R <SPACE>' and expects the partial upload warning, or the unknown ROM type warning
+func TestUploadCoverageFromRomTypeReply(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	tests := []struct {
+		reply   string
+		pad     bool
+		warning string
+	}{
+		{"R 12\r\n", false, "upload covers buffer 0x0-0x400 only, 2764 has 0x2000 bytes"},
+		{"R 7E\r\n", false, "ROM type is unknown, can't check that upload covers the full part"},
+		{"R 7E\r\n", true, "ROM type is unknown, image can't be padded"},
+	}
+	for _, test := range tests {
+		buf.Reset()
+		ando, tty := newFakeSession(func(keys string) string {
+			if keys == "R " {
+				return test.reply
+			}
+			return ""
+		})
+		ando.rangeLength = -1
+		ando.sumLength = -1
+		ando.pad = test.pad
+		ando.uploadFile = filepath.Join(t.TempDir(), "small.bin")
+		os.WriteFile(ando.uploadFile, make([]byte, 0x400), 0644)
+		uploadFile(ando)
+		if !strings.Contains(buf.String(), test.warning) {
+			t.Errorf("reply %q: logged %q, want %q", test.reply, buf.String(), test.warning)
+		}
+		if keys := tty.written.String(); !strings.HasPrefix(keys, "R U6\r") {
+			t.Errorf("reply %q: sent %.20q, want upload", test.reply, keys)
+		}
+	}
+}
+
+func TestCheckUploadSize(t *testing.T) {
+	ando := &AndoConnection{romType: findRomType("2716")}
+	if !checkUploadSize(ando, 2048) || checkUploadSize(ando, 2049) {
+		t.Errorf("2716 size check failed")
+	}
+	ando.force = true
+	if !checkUploadSize(ando, 4096) {
+		t.Errorf("--force did not allow upload")
+	}
+	if !checkUploadSize(&AndoConnection{}, 1<<20) {
+		t.Errorf("unknown ROM type refused upload")
+	}
+}
+
+func TestSelectRomType(t *testing.T) {
+	tests := []struct {
+		name     string
+		current  string // code EPrommer answers after selection
+		keys     string
+		ok       bool
+		selected string // ROM type of session afterwards
+	}{
+		{"2764", "12", "R12\rR ", true, "2764"},
+		{"27c256", "2C", "R2C\rR ", true, "27C256"},
+		{"27256", "2C", "R2C\rR ", true, "27256"},
+		{"2716", "00", "R00\rR ", true, "2716"},
+		{"27C1001", "CD", "RCD\rR ", true, "27C1001"},
+		{"2764", "2C", "R12\rR ", false, "27256"},
+		{"9999", "", "", false, "unknown"},
+	}
+	for _, test := range tests {
+		ando, tty := newFakeSession(func(keys string) string {
+			if keys == "R " {
+				return "R " + test.current + "\r\n"
+			}
+			return ""
+		})
+		if ok := selectRomType(ando, test.name); ok != test.ok {
+			t.Errorf("selectRomType(%v) = %v, want %v", test.name, ok, test.ok)
+		}
+		if tty.written.String() != test.keys {
+			t.Errorf("selectRomType(%v) sent %q, want %q", test.name, tty.written.String(), test.keys)
+		}
+		if romTypeName(ando) != test.selected {
+			t.Errorf("selectRomType(%v) selected %v, want %v", test.name, romTypeName(ando), test.selected)
+		}
+	}
+}
+
+func TestBatchSelectsRomType(t *testing.T) {
+	ando, tty := newFakeSession(func(keys string) string {
+		if keys == "R " {
+			return "R 7F\r\n"
+		}
+		return ""
+	})
+	ando.selectRomType = "27C040"
+	if exitCode := runBatch(ando, []string{"romtypes"}); exitCode != ExitOK {
+		t.Errorf("runBatch(romtypes) with --rom-type 27C040 = %v", exitCode)
+	}
+	if tty.written.String() != "R7F\rR " || romTypeName(ando) != "27C040" {
+		t.Errorf("sent %q, selected %v", tty.written.String(), romTypeName(ando))
+	}
+}
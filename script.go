@@ -0,0 +1,413 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Scripts are text files with one step per line, run with --script, the batch job 'script' or ': s'.
+// '#' starts a comment, arguments with blanks are quoted ("Insert master chip"). Steps:
+//
+//	send <keys>                  send keys, like in line mode (P D, R <SPACE>)
+//	wait <pattern> [timeout]     wait for pattern in EPrommer's output since last send, e.g. wait [PASS] 30s
+//	upload [file]                upload file (default --infile) and wait for '[PASS]'
+//	verify-file [file]           verify RAM buffer against file on device (U8)
+//	download [file]              download RAM buffer, if file is given it is written like ': w' does
+//	write [file]                 write data downloaded last to file (default --outfile)
+//	compare [file]               compare data downloaded last with reference file (default --reference)
+//	burn [file]                  blank check, upload, program and verify file
+//	assert <checksum> <value>    checksum of last download (sum16, sum32, crc16, crc32, md5, sha1, sha256, checksum)
+//	assert passed                last device command or transfer passed
+//	on-fail abort|continue       stop at first failing step (default) or continue
+//	abort-if-failed [message]    stop if a step has failed so far
+//	abort [message]              stop script
+//	pause [message]              wait for Enter, e.g. to change the chip in the socket
+//	sleep <duration>             e.g. sleep 2s
+//	log <message>                log message
+//	repeat <count> ... end       repeat steps
+//
+// Besides these the named device commands (blank, program, verify, copy, bpv, erase) and reset, romtype,
+// format and keys can be used.
+
+// scriptWaitTimeout default timeout of 'wait'
+const scriptWaitTimeout = 10 * time.Second
+
+// scriptNamedCommands named commands usable in scripts besides device commands
+var scriptNamedCommands = []string{"reset", "romtype", "format", "keys"}
+
+// ScriptStep step of script
+type ScriptStep struct {
+	line  int          // line number in script file
+	words []string     // command and arguments
+	steps []ScriptStep // steps of 'repeat'
+}
+
+// Script script being run
+type Script struct {
+	ando           *AndoConnection
+	file           string
+	keyboard       *bufio.Reader // keyboard in raw mode (: s), nil if run from command line
+	stdin          *bufio.Reader // standard input, used by 'pause' if keyboard is nil
+	continueOnFail bool
+	number         int // number of steps run
+	failed         int // number of failed steps
+}
+
+// splitScriptLine splits line into words, double quotes group words, '#' starts a comment
+func splitScriptLine(line string) []string {
+	var words []string
+	word := new(strings.Builder)
+	inWord := false
+	quoted := false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == '"':
+			quoted = !quoted
+			inWord = true
+		case quoted:
+			word.WriteByte(c)
+		case c == '#' && !inWord:
+			i = len(line)
+		case c == ' ' || c == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words
+}
+
+// parseScript parses script text into steps, unknown commands are reported with their line number
+func parseScript(text string) ([]ScriptStep, error) {
+	// stack of open 'repeat' blocks, bottom is script itself
+	stack := []*ScriptStep{{}}
+	for i, line := range strings.Split(text, "\n") {
+		words := splitScriptLine(strings.TrimRight(line, "\r"))
+		if len(words) == 0 {
+			continue
+		}
+		step := ScriptStep{line: i + 1, words: words}
+		words[0] = strings.ToLower(words[0])
+		switch words[0] {
+		case "repeat":
+			if len(words) != 2 {
+				return nil, fmt.Errorf("line %v: repeat needs a count", step.line)
+			}
+			if _, err := strconv.Atoi(words[1]); err != nil {
+				return nil, fmt.Errorf("line %v: illegal count %v", step.line, words[1])
+			}
+			parent := stack[len(stack)-1]
+			parent.steps = append(parent.steps, step)
+			stack = append(stack, &parent.steps[len(parent.steps)-1])
+			continue
+		case "end":
+			if len(stack) == 1 {
+				return nil, fmt.Errorf("line %v: end without repeat", step.line)
+			}
+			stack = stack[:len(stack)-1]
+			continue
+		case "send", "wait", "assert", "sleep":
+			if len(words) < 2 {
+				return nil, fmt.Errorf("line %v: %v needs an argument", step.line, words[0])
+			}
+		case "on-fail":
+			if len(words) != 2 || (words[1] != "abort" && words[1] != "continue") {
+				return nil, fmt.Errorf("line %v: on-fail needs abort or continue", step.line)
+			}
+		case "upload", "verify-file", "download", "write", "compare", "burn", "abort-if-failed", "abort",
+			"pause", "log":
+		default:
+			if !isScriptCommand(words[0]) {
+				return nil, fmt.Errorf("line %v: unknown command %v", step.line, words[0])
+			}
+		}
+		parent := stack[len(stack)-1]
+		parent.steps = append(parent.steps, step)
+	}
+	if len(stack) > 1 {
+		return nil, fmt.Errorf("line %v: repeat without end", stack[len(stack)-1].line)
+	}
+	return stack[0].steps, nil
+}
+
+// isScriptCommand returns true if name is a named command usable in scripts
+func isScriptCommand(name string) bool {
+	command := findNamedCommand(name)
+	if command == nil {
+		return false
+	}
+	if command.keys != nil {
+		return true
+	}
+	for _, allowed := range scriptNamedCommands {
+		if command.name == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// runScriptFile runs script file. keyboard is keyboard in raw mode, nil if run from command line.
+// Returns exit code like batch jobs: ExitOK if all steps passed, ExitFailed if a step failed or script
+// was aborted, ExitError if script could not be loaded.
+func runScriptFile(ando *AndoConnection, file string, keyboard *bufio.Reader) int {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		logf(ando, "Error loading script %s\n\r", err)
+		return ExitError
+	}
+	steps, err := parseScript(string(data))
+	if err != nil {
+		logf(ando, "Error in script %v: %s\n\r", file, err)
+		return ExitError
+	}
+	script := Script{ando: ando, file: file, keyboard: keyboard}
+	if keyboard == nil {
+		script.stdin = bufio.NewReader(os.Stdin)
+	}
+	logf(ando, "Running script %v\n\r", file)
+	completed := script.run(steps)
+	result := "completed"
+	if !completed {
+		result = "aborted"
+	}
+	logf(ando, "Script %v %v: %v steps, %v failed\n\r", file, result, script.number, script.failed)
+	if !completed || script.failed > 0 {
+		return ExitFailed
+	}
+	return ExitOK
+}
+
+// run runs steps, returns false if script was aborted
+func (script *Script) run(steps []ScriptStep) bool {
+	for _, step := range steps {
+		if !running(script.ando) {
+			return false
+		}
+		if step.words[0] == "repeat" {
+			count, _ := strconv.Atoi(step.words[1])
+			for i := 1; i <= count; i++ {
+				logf(script.ando, "Repeat %v/%v (line %v)\n\r", i, count, step.line)
+				if !script.run(step.steps) {
+					return false
+				}
+			}
+			continue
+		}
+		script.number++
+		logf(script.ando, "Step %v (%v:%v): %v\n\r", script.number, script.file, step.line, strings.Join(step.words, " "))
+		start := time.Now()
+		passed, abort := script.runStep(step.words[0], step.words[1:])
+		result := "PASS"
+		if !passed {
+			result = "FAIL"
+			script.failed++
+		}
+		logf(script.ando, "Step %v %v in %.1fs\n\r", script.number, result, time.Since(start).Seconds())
+		if abort {
+			return false
+		}
+		if !passed && !script.continueOnFail {
+			logf(script.ando, "Aborting script after failed step (line %v)\n\r", step.line)
+			return false
+		}
+	}
+	return true
+}
+
+// runStep runs a step. Returns whether step passed and whether script is to be aborted.
+func (script *Script) runStep(command string, args []string) (bool, bool) {
+	ando := script.ando
+	switch command {
+	case "send":
+		resetConsole(ando)
+		return sendKeys(ando, parseKeyLine(strings.Join(args, " "))), false
+	case "wait":
+		timeout := scriptWaitTimeout
+		if len(args) > 1 {
+			var ok bool
+			if timeout, ok = parseScriptDuration(args[1]); !ok {
+				logf(script.ando, "Illegal timeout %v\n\r", args[1])
+				return false, false
+			}
+		}
+		return waitForPattern(ando, args[0], timeout), false
+	case "upload":
+		if len(args) > 0 {
+			ando.uploadFile = args[0]
+		}
+		return uploadAndWait(ando), false
+	case "verify-file":
+		if len(args) > 0 {
+			ando.uploadFile = args[0]
+		}
+		ando.lastPassed = false
+		verifyFileOnDevice(ando)
+		if !waitForState(ando, NormalInput, ando.serial.timeout) {
+			logf(script.ando, "Device verify did not complete within %v\n\r", ando.serial.timeout)
+			ando.state = NormalInput
+			return false, false
+		}
+		return ando.lastPassed, false
+	case "download":
+		if !downloadImage(ando) {
+			return false, false
+		}
+		if len(args) > 0 {
+			ando.downloadFile = args[0]
+			writeDataToFile(ando)
+		}
+		return true, false
+	case "write":
+		if len(ando.lineInfos) == 0 {
+			logf(script.ando, "No data downloaded yet\n\r")
+			return false, false
+		}
+		if len(args) > 0 {
+			ando.downloadFile = args[0]
+		}
+		writeDataToFile(ando)
+		return true, false
+	case "compare":
+		if len(args) > 0 {
+			ando.referenceFile = args[0]
+		}
+		return verifyDownload(ando), false
+	case "burn":
+		if len(args) > 0 {
+			ando.uploadFile = args[0]
+		}
+		return burn(ando), false
+	case "assert":
+		return scriptAssert(ando, args), false
+	case "on-fail":
+		script.continueOnFail = args[0] == "continue"
+		return true, false
+	case "abort-if-failed":
+		if script.failed > 0 {
+			logf(script.ando, "Aborting script, %v steps failed: %v\n\r", script.failed, strings.Join(args, " "))
+			return true, true
+		}
+		return true, false
+	case "abort":
+		logf(script.ando, "Aborting script: %v\n\r", strings.Join(args, " "))
+		return false, true
+	case "pause":
+		return true, !script.pause(strings.Join(args, " "))
+	case "sleep":
+		duration, ok := parseScriptDuration(args[0])
+		if !ok {
+			logf(script.ando, "Illegal duration %v\n\r", args[0])
+			return false, false
+		}
+		time.Sleep(duration)
+		return true, false
+	case "log":
+		logf(script.ando, "%v\n\r", strings.Join(args, " "))
+		return true, false
+	}
+	command = strings.ToLower(command)
+	named := findNamedCommand(command)
+	runNamedCommand(ando, script.keyboard, strings.Join(append([]string{command}, args...), " "))
+	if named.keys != nil {
+		return ando.lastPassed, false
+	}
+	if command == "romtype" && len(args) > 0 {
+		return ando.romType != nil && ando.romType == findRomType(args[0]), false
+	}
+	return true, false
+}
+
+// pause waits for Enter, returns false if script is to be aborted
+func (script *Script) pause(message string) bool {
+	if message == "" {
+		message = "Paused"
+	}
+	if script.keyboard != nil {
+		_, ok := editLine(script.keyboard, "\n\r"+message+" (Enter continues, ESC aborts) > ", nil, nil)
+		return ok
+	}
+	fmt.Printf("%v (Enter continues) > ", message)
+	_, err := script.stdin.ReadString('\n')
+	if err != nil {
+		logf(script.ando, "No input to continue script: %s\n\r", err)
+		return false
+	}
+	return true
+}
+
+// waitForPattern waits until pattern is found in EPrommer's output. Returns false on timeout.
+func waitForPattern(ando *AndoConnection, pattern string, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for !strings.Contains(consoleText(ando), pattern) {
+		if time.Now().After(deadline) || !running(ando) {
+			logf(ando, "'%v' not received within %v\n\r", pattern, timeout)
+			return false
+		}
+		time.Sleep(25 * time.Millisecond)
+	}
+	return true
+}
+
+// scriptAssert checks assertion on last download or result, e.g. "crc32 1e245007" or "passed"
+func scriptAssert(ando *AndoConnection, args []string) bool {
+	if args[0] == "passed" {
+		if !ando.lastPassed {
+			logf(ando, "Assertion failed: last command did not pass (reply '%v')\n\r", ando.lastReply)
+		}
+		return ando.lastPassed
+	}
+	if len(args) != 2 {
+		logf(ando, "assert needs checksum name and value\n\r")
+		return false
+	}
+	if len(ando.lineInfos) == 0 {
+		logf(ando, "Assertion failed: no data downloaded yet\n\r")
+		return false
+	}
+	sums := checksumMap(ando.checksums)
+	sums["checksum"] = fmt.Sprintf("%06x", ando.checksum)
+	actual, found := sums[strings.ToLower(args[0])]
+	if !found || args[0] == "range" {
+		logf(ando, "Unknown checksum %v\n\r", args[0])
+		return false
+	}
+	if !sameHex(actual, args[1]) {
+		logf(ando, "Assertion failed: %v is %v, expected %v\n\r", args[0], actual, args[1])
+		return false
+	}
+	logf(ando, "%v is %v as expected\n\r", args[0], actual)
+	return true
+}
+
+// sameHex compares hex values, ignoring case, "0x" prefix and leading zeroes
+func sameHex(a string, b string) bool {
+	normalize := func(value string) string {
+		value = strings.TrimPrefix(strings.ToLower(value), "0x")
+		value = strings.TrimLeft(value, "0")
+		return value
+	}
+	return normalize(a) == normalize(b)
+}
+
+// parseScriptDuration parses a duration like "2s" or "500ms", a plain number is seconds
+func parseScriptDuration(text string) (time.Duration, bool) {
+	if seconds, err := strconv.ParseFloat(text, 64); err == nil {
+		return time.Duration(seconds * float64(time.Second)), true
+	}
+	duration, err := time.ParseDuration(text)
+	return duration, err == nil
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSplitScriptLine(t *testing.T) {
+	tests := []struct {
+		line  string
+		words []string
+	}{
+		{"send P D", []string{"send", "P", "D"}},
+		{"  wait\t[PASS]   30s ", []string{"wait", "[PASS]", "30s"}},
+		{`pause "Insert master chip"`, []string{"pause", "Insert master chip"}},
+		{`log "# not a comment"`, []string{"log", "# not a comment"}},
+		{"send R <SPACE> # query ROM type", []string{"send", "R", "<SPACE>"}},
+		{"# comment only", nil},
+		{`log ""`, []string{"log", ""}},
+		{"log a#b", []string{"log", "a#b"}},
+		{"", nil},
+	}
+	for _, test := range tests {
+		if words := splitScriptLine(test.line); !reflect.DeepEqual(words, test.words) {
+			t.Errorf("splitScriptLine(%q) = %q, want %q", test.line, words, test.words)
+		}
+	}
+}
+
+func TestParseScript(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		steps  []ScriptStep
+		errMsg string
+	}{
+		{"steps", "# burn\r\nBLANK\r\n\r\nburn fw.bin\r\n", []ScriptStep{
+			{line: 2, words: []string{"blank"}},
+			{line: 4, words: []string{"burn", "fw.bin"}},
+		}, ""},
+		{"repeat", "repeat 2\n  send P C\n  repeat 3\n    log x\n  end\nend\nlog done", []ScriptStep{
+			{line: 1, words: []string{"repeat", "2"}, steps: []ScriptStep{
+				{line: 2, words: []string{"send", "P", "C"}},
+				{line: 3, words: []string{"repeat", "3"}, steps: []ScriptStep{{line: 4, words: []string{"log", "x"}}}},
+			}},
+			{line: 7, words: []string{"log", "done"}},
+		}, ""},
+		{"named commands", "romtype 2764\nformat hp64k\nkeys DEVICE BLANK SET\nreset", []ScriptStep{
+			{line: 1, words: []string{"romtype", "2764"}},
+			{line: 2, words: []string{"format", "hp64k"}},
+			{line: 3, words: []string{"keys", "DEVICE", "BLANK", "SET"}},
+			{line: 4, words: []string{"reset"}},
+		}, ""},
+		{"unknown command", "log x\nflash fw.bin", nil, "line 2: unknown command flash"},
+		{"not usable in scripts", "quit", nil, "line 1: unknown command quit"},
+		{"missing argument", "wait", nil, "line 1: wait needs an argument"},
+		{"on-fail", "on-fail retry", nil, "line 1: on-fail needs abort or continue"},
+		{"repeat count", "repeat often\nend", nil, "line 1: illegal count often"},
+		{"repeat without count", "repeat\nend", nil, "line 1: repeat needs a count"},
+		{"repeat without end", "log x\nrepeat 2\nlog y", nil, "line 2: repeat without end"},
+		{"end without repeat", "end", nil, "line 1: end without repeat"},
+	}
+	for _, test := range tests {
+		steps, err := parseScript(test.text)
+		errMsg := ""
+		if err != nil {
+			errMsg = err.Error()
+		}
+		if errMsg != test.errMsg || !reflect.DeepEqual(steps, test.steps) {
+			t.Errorf("%v: parseScript() = %v, %q, want %v, %q", test.name, steps, errMsg, test.steps, test.errMsg)
+		}
+	}
+}
+
+func TestScriptRun(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		completed bool
+		number    int
+		failed    int
+		keys      string
+	}{
+		{"send and wait", "send P D\nwait [PASS] 1s", true, 2, 0, "PD\r"},
+		{"repeat", "repeat 3\nsend R <SPACE>\nend", true, 3, 0, "R R R "},
+		{"named command keys", "keys DEVICE BLANK SET\nlog done", true, 2, 0, "PC\r"},
+		{"wait timeout aborts", "send R <SPACE>\nwait [PASS] 0.1\nlog not reached", false, 2, 1, "R "},
+		{"on-fail continue", "on-fail continue\nsend R <SPACE>\nwait [PASS] 0.1\nlog reached", true, 4, 1, "R "},
+		{"abort-if-failed", "on-fail continue\nsend R <SPACE>\nwait [PASS] 0.1\nabort-if-failed\nlog x", false, 4, 1, "R "},
+		{"abort", "abort wrong chip\nlog not reached", false, 1, 1, ""},
+		{"assert without download", "assert crc32 1e245007", false, 1, 1, ""},
+	}
+	for _, test := range tests {
+		ando, tty := newFakeSession(func(keys string) string {
+			if strings.HasSuffix(keys, "\r") {
+				return keys + "\r\n[PASS]\r\n"
+			}
+			return keys + "\r\n0A\r\n"
+		})
+		steps, err := parseScript(test.text)
+		if err != nil {
+			t.Fatalf("%v: %v", test.name, err)
+		}
+		script := Script{ando: ando, file: "test.txt"}
+		completed := script.run(steps)
+		if completed != test.completed || script.number != test.number || script.failed != test.failed {
+			t.Errorf("%v: run() = %v, %v steps, %v failed, want %v, %v, %v", test.name, completed, script.number,
+				script.failed, test.completed, test.number, test.failed)
+		}
+		if keys := tty.written.String(); keys != test.keys {
+			t.Errorf("%v: sent %q, want %q", test.name, keys, test.keys)
+		}
+	}
+}
+
+// TestScriptWaitConcurrent answers keys from another goroutine, like ttyReader does
+func TestScriptWaitConcurrent(t *testing.T) {
+	var ando *AndoConnection
+	var wg sync.WaitGroup
+	ando, _ = newFakeSession(func(keys string) string {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, chunk := range []string{"PD\r\n", "[PA", "SS]\r\n"} {
+				time.Sleep(20 * time.Millisecond)
+				captureConsole(ando, []byte(chunk))
+			}
+		}()
+		return ""
+	})
+	steps, err := parseScript("repeat 2\nsend P D\nwait [PASS] 1s\nend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := Script{ando: ando, file: "test.txt"}
+	if !script.run(steps) || script.failed != 0 {
+		t.Errorf("run() failed, %v steps failed", script.failed)
+	}
+	wg.Wait()
+}
+
+func TestSameHex(t *testing.T) {
+	tests := []struct {
+		a    string
+		b    string
+		same bool
+	}{
+		{"1e245007", "1E245007", true},
+		{"0x1e245007", "1e245007", true},
+		{"00ff", "ff", true},
+		{"0000", "0", true},
+		{"ff", "fe", false},
+	}
+	for _, test := range tests {
+		if same := sameHex(test.a, test.b); same != test.same {
+			t.Errorf("sameHex(%v, %v) = %v, want %v", test.a, test.b, same, test.same)
+		}
+	}
+}
+
+func TestParseScriptDuration(t *testing.T) {
+	tests := []struct {
+		text     string
+		duration time.Duration
+		ok       bool
+	}{
+		{"2s", 2 * time.Second, true},
+		{"500ms", 500 * time.Millisecond, true},
+		{"30", 30 * time.Second, true},
+		{"0.5", 500 * time.Millisecond, true},
+		{"1m30s", 90 * time.Second, true},
+		{"soon", 0, false},
+	}
+	for _, test := range tests {
+		duration, ok := parseScriptDuration(test.text)
+		if duration != test.duration || ok != test.ok {
+			t.Errorf("parseScriptDuration(%q) = %v, %v, want %v, %v", test.text, duration, ok, test.duration, test.ok)
+		}
+	}
+}
@@ -11,8 +11,11 @@ import (
 	"syscall"
 )
 
-// openTTY opens TTY connection
+// openTTY opens TTY connection, or network connection for tcp:// and rfc2217:// devices
 func (ando *AndoSerialConnection) openTTY() (err error) {
+	if isNetworkDevice(ando.device) {
+		return ando.openNetwork()
+	}
 	tty, err := os.OpenFile(ando.device, syscall.O_RDWR|syscall.O_NOCTTY|syscall.O_NONBLOCK, 0666)
 	if err != nil {
 		return
@@ -48,7 +51,7 @@ func (ando *AndoSerialConnection) openTTY() (err error) {
 		speed = C.B2400
 	default:
 		tty.Close()
-		return fmt.Errorf("Unknown/unsupported baud rate %s", ando.baudrate)
+		return fmt.Errorf("Unknown/unsupported baud rate %d", ando.baudrate)
 	}
 
 	_, err = C.cfsetispeed(&st, speed)
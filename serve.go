@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// In serve mode the local TTY is exposed over TCP, so the EPrommer can be used from other machines
+// with --device tcp://host:port. One client at a time has the session and may send to the EPrommer,
+// observers (on a second port) get all output of the EPrommer, but cannot send.
+
+// ServeClient a client connected in serve mode
+type ServeClient struct {
+	conn     net.Conn
+	observer bool
+	output   chan []byte // output of EPrommer to be sent to client
+	since    time.Time
+	sent     int  // bytes sent by client to EPrommer
+	received int  // bytes of EPrommer output sent to client
+	dropped  int  // bytes of EPrommer output dropped, because client did not keep up
+	overrun  bool // output queue of session client was full, client is disconnected
+}
+
+// Server state of serve mode
+type Server struct {
+	ando      *AndoConnection
+	mutex     sync.Mutex
+	session   *ServeClient // client having the session, nil if none
+	observers map[*ServeClient]bool
+	listeners []net.Listener
+	failed    bool // TTY failed, server is shut down
+}
+
+// serveOutputQueue number of EPrommer output chunks queued per client
+const serveOutputQueue = 1024
+
+// serve runs serve mode: serve [address] [observer address]. Runs until TTY fails.
+func serve(ando *AndoConnection, args []string) int {
+	address := ":4000"
+	if len(args) > 1 {
+		address = args[1]
+	}
+	if ando.dryMode {
+		log.Printf("serve requires a device, it does not work in dry mode\n\r")
+		return ExitError
+	}
+	server := &Server{ando: ando, observers: make(map[*ServeClient]bool)}
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		log.Printf("Error listening on %v: %s\n\r", address, err)
+		return ExitError
+	}
+	server.listeners = append(server.listeners, listener)
+	log.Printf("Serving %v on %v\n\r", ando.serial.device, listener.Addr())
+	if len(args) > 2 {
+		observerListener, err := net.Listen("tcp", args[2])
+		if err != nil {
+			log.Printf("Error listening on %v: %s\n\r", args[2], err)
+			return ExitError
+		}
+		server.listeners = append(server.listeners, observerListener)
+		log.Printf("Observers (read-only) on %v\n\r", observerListener.Addr())
+		go server.accept(observerListener, true)
+	}
+	go server.readTTY()
+	server.accept(listener, false)
+	if server.failed {
+		return ExitError
+	}
+	return ExitOK
+}
+
+// accept accepts clients until listener is closed
+func (server *Server) accept(listener net.Listener, observer bool) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if !server.failed {
+				log.Printf("Error accepting connection: %s\n\r", err)
+			}
+			return
+		}
+		go server.handleClient(conn, observer)
+	}
+}
+
+// readTTY sends all output of EPrommer to all clients. Shuts down server if TTY fails.
+func (server *Server) readTTY() {
+	cbuf := make([]byte, 128)
+	for {
+		num, err := server.ando.serial.tty.Read(cbuf)
+		if err != nil {
+			log.Printf("Error in Read: %s, shutting down\n\r", err)
+			server.mutex.Lock()
+			server.failed = true
+			server.mutex.Unlock()
+			for _, listener := range server.listeners {
+				listener.Close()
+			}
+			return
+		}
+		chunk := make([]byte, num)
+		copy(chunk, cbuf[:num])
+		server.mutex.Lock()
+		if server.session != nil {
+			server.session.queue(chunk)
+		}
+		for client := range server.observers {
+			client.queue(chunk)
+		}
+		server.mutex.Unlock()
+	}
+}
+
+// queue queues output for client. Output for observers is dropped if they do not keep up. The client
+// having the session is disconnected instead, as a transfer with missing data would look complete.
+func (client *ServeClient) queue(chunk []byte) {
+	select {
+	case client.output <- chunk:
+		client.received += len(chunk)
+		return
+	default:
+		client.dropped += len(chunk)
+	}
+	if !client.observer && !client.overrun {
+		client.overrun = true
+		log.Printf("%v does not keep up with EPrommer output, disconnecting\n\r", client.conn.RemoteAddr())
+		client.conn.Close()
+	}
+}
+
+// handleClient registers client as session or observer and passes data until client disconnects
+func (server *Server) handleClient(conn net.Conn, observer bool) {
+	client := &ServeClient{
+		conn:     conn,
+		observer: observer,
+		output:   make(chan []byte, serveOutputQueue),
+		since:    time.Now(),
+	}
+	role := "session"
+	if observer {
+		role = "observer"
+	}
+	server.mutex.Lock()
+	if !observer && server.session != nil {
+		busy := server.session.conn.RemoteAddr()
+		server.mutex.Unlock()
+		log.Printf("Refused %v, session is used by %v\n\r", conn.RemoteAddr(), busy)
+		fmt.Fprintf(conn, "EPrommer is used by %v\r\n", busy)
+		conn.Close()
+		return
+	}
+	if observer {
+		server.observers[client] = true
+	} else {
+		server.session = client
+	}
+	server.mutex.Unlock()
+	log.Printf("%v connected (%v)\n\r", conn.RemoteAddr(), role)
+
+	go func() {
+		for chunk := range client.output {
+			_, err := conn.Write(chunk)
+			if err != nil {
+				conn.Close()
+				return
+			}
+		}
+	}()
+
+	cbuf := make([]byte, 128)
+	for {
+		num, err := conn.Read(cbuf)
+		if err != nil {
+			break
+		}
+		if observer {
+			// observers are read-only
+			continue
+		}
+		_, err = server.ando.serial.tty.Write(cbuf[:num])
+		if err != nil {
+			log.Printf("Error in Write: %s\n\r", err)
+			break
+		}
+		client.sent += num
+	}
+
+	server.mutex.Lock()
+	if observer {
+		delete(server.observers, client)
+	} else {
+		server.session = nil
+	}
+	close(client.output)
+	server.mutex.Unlock()
+	conn.Close()
+	log.Printf("%v disconnected (%v) after %v, %v bytes to EPrommer, %v bytes from EPrommer, %v bytes dropped\n\r",
+		conn.RemoteAddr(), role, time.Since(client.since).Round(time.Second), client.sent, client.received, client.dropped)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net"
+	"testing"
+)
+
+func TestServeClientQueue(t *testing.T) {
+	tests := []struct {
+		name         string
+		observer     bool
+		chunks       int
+		received     int
+		dropped      int
+		disconnected bool
+	}{
+		{"session keeping up", false, 2, 4, 0, false},
+		{"session overrun", false, 4, 4, 4, true},
+		{"observer keeping up", true, 2, 4, 0, false},
+		{"observer overrun", true, 4, 4, 4, false},
+	}
+	for _, test := range tests {
+		conn, peer := net.Pipe()
+		client := &ServeClient{conn: conn, observer: test.observer, output: make(chan []byte, 2)}
+		for range test.chunks {
+			client.queue([]byte("ab"))
+		}
+		if client.received != test.received || client.dropped != test.dropped {
+			t.Errorf("%v: received %v, dropped %v, want %v, %v", test.name, client.received, client.dropped,
+				test.received, test.dropped)
+		}
+		// writing to the peer fails once the client connection is closed
+		go conn.Read(make([]byte, 1))
+		_, err := peer.Write([]byte("x"))
+		if disconnected := err != nil; disconnected != test.disconnected {
+			t.Errorf("%v: disconnected %v, want %v", test.name, disconnected, test.disconnected)
+		}
+		conn.Close()
+		peer.Close()
+	}
+}
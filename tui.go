@@ -0,0 +1,352 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// The full-screen terminal UI (--tui) shows output of EPrommer and the app's log in separate panes,
+// with a status bar on top and a key help footer. Standard output and log are redirected into the log
+// pane, output of EPrommer is taken from captureConsole. Hex editor and diff viewer draw on the
+// terminal directly, the terminal UI pauses while they are shown.
+
+// terminalOutput terminal, full-screen views write to it also while standard output is redirected
+var terminalOutput io.Writer = os.Stdout
+
+// terminalUI full-screen terminal UI, nil if not used
+var terminalUI *TUI
+
+// tuiMaxLines number of lines kept per pane
+const tuiMaxLines = 1000
+
+// tuiNormalHelp key help shown in footer in normal input
+const tuiNormalHelp = ": compound command  @ RESET  PA<CR> copy  PC<CR> blank  PD<CR> program  PE<CR> verify  " +
+	"R<SPACE> ROM type  U5<SPACE><CR> format"
+
+// tuiCommandHelp key help shown in footer after ':'
+const tuiCommandHelp = "q quit  d download  c compare  w write  u upload  v verify  b burn  p program check  " +
+	"t ROM type  e edit  x diff  f format  l line mode  n named command  s script  : back"
+
+// TUIPane lines of text shown in a pane, last line may still be incomplete
+type TUIPane struct {
+	title string
+	lines []string
+}
+
+// TUI full-screen terminal UI
+type TUI struct {
+	ando     *AndoConnection
+	mutex    sync.Mutex
+	console  TUIPane  // output of EPrommer
+	log      TUIPane  // standard output and log of app
+	prompt   string   // prompt shown in footer while a line is read, "" if none
+	input    string   // input read so far
+	cursor   int      // position of cursor in input
+	frame    string   // screen drawn last
+	paused   bool     // full-screen view is shown
+	terminal *os.File // terminal, standard output is redirected to pipe
+	pipe     *os.File // write end of pipe standard output is redirected to
+	resize   chan os.Signal
+	done     chan bool
+}
+
+// write appends text to pane. CR is ignored, backspace removes last char of line.
+func (pane *TUIPane) write(text string) {
+	if len(pane.lines) == 0 {
+		pane.lines = []string{""}
+	}
+	last := len(pane.lines) - 1
+	line := []byte(pane.lines[last])
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; c {
+		case '\r':
+		case '\n':
+			pane.lines[last] = string(line)
+			pane.lines = append(pane.lines, "")
+			last++
+			line = nil
+		case '\b':
+			if len(line) > 0 {
+				line = line[:len(line)-1]
+			}
+		case '\t':
+			line = append(line, ' ')
+			for len(line)%8 != 0 {
+				line = append(line, ' ')
+			}
+		default:
+			if c >= 0x20 || c == 0x1b {
+				line = append(line, c)
+			}
+		}
+	}
+	pane.lines[last] = string(line)
+	if len(pane.lines) > tuiMaxLines {
+		pane.lines = pane.lines[len(pane.lines)-tuiMaxLines:]
+	}
+}
+
+// visible returns last rows lines of pane
+func (pane *TUIPane) visible(rows int) []string {
+	lines := pane.lines
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) > rows {
+		lines = lines[len(lines)-rows:]
+	}
+	return lines
+}
+
+// startTUI switches terminal into full-screen terminal UI
+func startTUI(ando *AndoConnection) (*TUI, error) {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	tui := &TUI{
+		ando:     ando,
+		console:  TUIPane{title: "EPrommer"},
+		log:      TUIPane{title: "Log"},
+		terminal: os.Stdout,
+		pipe:     writer,
+		resize:   make(chan os.Signal, 1),
+		done:     make(chan bool),
+	}
+	os.Stdout = writer
+	log.SetOutput(writer)
+	// output of EPrommer is shown in console pane, not printed
+	ando.quiet = true
+	hook := ando.consoleHook
+	ando.consoleHook = func(chunk []byte) {
+		tui.mutex.Lock()
+		tui.console.write(string(chunk))
+		tui.mutex.Unlock()
+		if hook != nil {
+			hook(chunk)
+		}
+	}
+	signal.Notify(tui.resize, syscall.SIGWINCH)
+	fmt.Fprint(tui.terminal, "\x1b[?1049h\x1b[2J")
+	go tui.readLog(reader)
+	go tui.run()
+	return tui, nil
+}
+
+// stop leaves full-screen terminal UI and restores standard output
+func (tui *TUI) stop() {
+	close(tui.done)
+	signal.Stop(tui.resize)
+	os.Stdout = tui.terminal
+	log.SetOutput(os.Stderr)
+	tui.pipe.Close()
+	fmt.Fprint(tui.terminal, "\x1b[?25h\x1b[?1049l")
+}
+
+// readLog reads standard output and log of app into log pane
+func (tui *TUI) readLog(reader *os.File) {
+	buf := make([]byte, 4096)
+	for {
+		num, err := reader.Read(buf)
+		if err != nil {
+			return
+		}
+		tui.mutex.Lock()
+		tui.log.write(string(buf[:num]))
+		tui.mutex.Unlock()
+	}
+}
+
+// run redraws screen when content, state of session or terminal size has changed
+func (tui *TUI) run() {
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-tui.done:
+			return
+		case <-tui.resize:
+			tui.mutex.Lock()
+			tui.frame = ""
+			tui.mutex.Unlock()
+		case <-ticker.C:
+		}
+		tui.draw()
+	}
+}
+
+// isPaused returns true while a full-screen view (hex editor, diff viewer) is shown
+func (tui *TUI) isPaused() bool {
+	return tui.ando.state == Editing
+}
+
+// draw draws screen if it has changed. After a full-screen view was shown, screen is drawn completely.
+func (tui *TUI) draw() {
+	tui.mutex.Lock()
+	defer tui.mutex.Unlock()
+	if tui.isPaused() {
+		tui.paused = true
+		return
+	}
+	if tui.paused {
+		tui.paused = false
+		tui.frame = ""
+	}
+	width, height, err := term.GetSize(int(tui.terminal.Fd()))
+	if err != nil || width < 20 || height < 8 {
+		width, height = 80, 24
+	}
+	frame := tui.render(width, height)
+	if frame == tui.frame {
+		return
+	}
+	if tui.frame == "" {
+		fmt.Fprint(tui.terminal, "\x1b[2J")
+	}
+	tui.frame = frame
+	fmt.Fprint(tui.terminal, frame)
+}
+
+// render returns screen for terminal size: status bar, console pane, log pane and footer
+func (tui *TUI) render(width int, height int) string {
+	rows := height - 4
+	consoleRows := rows * 3 / 5
+	logRows := rows - consoleRows
+	sb := new(strings.Builder)
+	sb.WriteString("\x1b[?25l")
+	row := 1
+	line := func(style string, text string) {
+		fmt.Fprintf(sb, "\x1b[%d;1H%v%v\x1b[K\x1b[0m", row, style, fitLine(text, width))
+		row++
+	}
+	line("\x1b[7m", padLine(tui.statusText(), width))
+	line("\x1b[1m", paneTitle(tui.console.title, width))
+	console := tui.console.visible(consoleRows)
+	for i := 0; i < consoleRows; i++ {
+		if i < len(console) {
+			line("", console[i])
+		} else {
+			line("", "")
+		}
+	}
+	cursorRow := 3
+	cursorColumn := 1
+	if len(console) > 0 {
+		cursorRow = 2 + len(console)
+		cursorColumn = len([]rune(fitLine(console[len(console)-1], width))) + 1
+	}
+	line("\x1b[1m", paneTitle(tui.log.title, width))
+	logLines := tui.log.visible(logRows)
+	for i := 0; i < logRows; i++ {
+		if i < len(logLines) {
+			line("", logLines[i])
+		} else {
+			line("", "")
+		}
+	}
+	if tui.prompt != "" {
+		line("", tui.prompt+tui.input)
+		cursorRow = height
+		cursorColumn = len(tui.prompt) + tui.cursor + 1
+	} else if progress := activeProgress(tui.ando); progress != nil {
+		line("", fmt.Sprintf("[%v] %v", progress.bar(progressBarWidth), progress))
+	} else if tui.ando.state == CommandInput {
+		line("\x1b[7m", padLine(tuiCommandHelp, width))
+	} else {
+		line("\x1b[2m", tuiNormalHelp)
+	}
+	if cursorColumn > width {
+		cursorColumn = width
+	}
+	fmt.Fprintf(sb, "\x1b[%d;%dH\x1b[?25h", cursorRow, cursorColumn)
+	return sb.String()
+}
+
+// connectionText returns state of connection to EPrommer and its device or URL,
+// e.g. "connected /dev/ttyUSB0 19200 baud"
+func connectionText(ando *AndoConnection) string {
+	state := "connected"
+	if ando.dryMode {
+		state = "dry-run, not connected"
+	} else if ando.serial.tty == nil || !running(ando) {
+		// ttyReader stops session when reading from device fails
+		state = "disconnected"
+	}
+	if strings.HasPrefix(ando.serial.device, "tcp://") {
+		// baud rate is set on the other end of a raw TCP connection
+		return fmt.Sprintf("%v %v", state, ando.serial.device)
+	}
+	return fmt.Sprintf("%v %v %v baud", state, ando.serial.device, ando.serial.baudrate)
+}
+
+// statusText returns text of status bar
+func (tui *TUI) statusText() string {
+	ando := tui.ando
+	text := fmt.Sprintf(" %v | %v | %v | ROM type %v | firmware %v", ando.state, connectionText(ando),
+		ando.transferFormat, romTypeName(ando), firmwareName(ando))
+	if len(ando.lineInfos) > 0 {
+		text += fmt.Sprintf(" | checksum %06x crc32 %08x", ando.checksum, ando.checksums.crc32)
+	}
+	return text + " "
+}
+
+// setInput sets prompt and line being edited shown in footer, cursor is position in line
+func (tui *TUI) setInput(prompt string, input string, cursor int) {
+	tui.mutex.Lock()
+	tui.prompt = prompt
+	tui.input = input
+	tui.cursor = cursor
+	tui.mutex.Unlock()
+}
+
+// paneTitle returns title line of pane
+func paneTitle(title string, width int) string {
+	return "── " + title + " " + strings.Repeat("─", max(0, width-len(title)-4))
+}
+
+// padLine pads text with spaces to width
+func padLine(text string, width int) string {
+	if len(text) < width {
+		return text + strings.Repeat(" ", width-len(text))
+	}
+	return text
+}
+
+// fitLine cuts text to width chars, ANSI escape sequences are removed
+func fitLine(text string, width int) string {
+	if strings.IndexByte(text, 0x1b) >= 0 {
+		text = stripANSI(text)
+	}
+	runes := []rune(text)
+	if len(runes) > width {
+		return string(runes[:width])
+	}
+	return text
+}
+
+// stripANSI removes ANSI escape sequences (ESC [ ... letter) from text
+func stripANSI(text string) string {
+	sb := new(strings.Builder)
+	for i := 0; i < len(text); i++ {
+		if text[i] != 0x1b {
+			sb.WriteByte(text[i])
+			continue
+		}
+		if i+1 < len(text) && text[i+1] == '[' {
+			i += 2
+			for i < len(text) && !(text[i] >= 0x40 && text[i] <= 0x7e) {
+				i++
+			}
+		}
+	}
+	return sb.String()
+}
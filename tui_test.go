@@ -0,0 +1,160 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestConnectionText(t *testing.T) {
+	tests := []struct {
+		device  string
+		tty     bool
+		running bool
+		dryMode bool
+		text    string
+	}{
+		{"/dev/ttyUSB0", true, true, false, "connected /dev/ttyUSB0 19200 baud"},
+		{"rfc2217://lab-pi:4001", true, true, false, "connected rfc2217://lab-pi:4001 19200 baud"},
+		{"tcp://lab-pi:4000", true, true, false, "connected tcp://lab-pi:4000"},
+		{"/dev/ttyUSB0", true, false, false, "disconnected /dev/ttyUSB0 19200 baud"},
+		{"/dev/ttyUSB0", false, true, false, "disconnected /dev/ttyUSB0 19200 baud"},
+		{"/dev/ttyUSB0", false, true, true, "dry-run, not connected /dev/ttyUSB0 19200 baud"},
+	}
+	for _, test := range tests {
+		ando, _ := newFakeSession(nil)
+		ando.serial.device = test.device
+		ando.serial.baudrate = 19200
+		ando.dryMode = test.dryMode
+		if !test.tty {
+			ando.serial.tty = nil
+		}
+		if !test.running {
+			stopRunning(ando)
+		}
+		if text := connectionText(ando); text != test.text {
+			t.Errorf("connectionText() = %q, want %q", text, test.text)
+		}
+	}
+}
+
+func TestTUIPaneWrite(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes []string
+		lines  []string
+	}{
+		{"lines", []string{"PASS\r\nFAIL\r\n"}, []string{"PASS", "FAIL", ""}},
+		{"incomplete line", []string{"R ", "0A\r\n"}, []string{"R 0A", ""}},
+		{"backspace", []string{"PX\bD\b\b"}, []string{""}},
+		{"tab", []string{"a\tb"}, []string{"a       b"}},
+		{"control chars", []string{"a\x00\x07b\x1b[1m"}, []string{"ab\x1b[1m"}},
+	}
+	for _, test := range tests {
+		pane := TUIPane{}
+		for _, text := range test.writes {
+			pane.write(text)
+		}
+		if !reflect.DeepEqual(pane.lines, test.lines) {
+			t.Errorf("%v: lines %q, want %q", test.name, pane.lines, test.lines)
+		}
+	}
+}
+
+func TestTUIPaneLimit(t *testing.T) {
+	pane := TUIPane{}
+	pane.write(strings.Repeat("x\n", tuiMaxLines+10))
+	if len(pane.lines) != tuiMaxLines {
+		t.Errorf("pane keeps %v lines, want %v", len(pane.lines), tuiMaxLines)
+	}
+}
+
+func TestTUIPaneVisible(t *testing.T) {
+	tests := []struct {
+		lines   []string
+		rows    int
+		visible []string
+	}{
+		{[]string{"a", "b", "c", ""}, 2, []string{"b", "c"}},
+		{[]string{"a", "b", "c"}, 2, []string{"b", "c"}},
+		{[]string{"a", ""}, 5, []string{"a"}},
+		{nil, 3, nil},
+	}
+	for _, test := range tests {
+		pane := TUIPane{lines: test.lines}
+		if visible := pane.visible(test.rows); !reflect.DeepEqual(visible, test.visible) {
+			t.Errorf("visible(%v) of %q = %q, want %q", test.rows, test.lines, visible, test.visible)
+		}
+	}
+}
+
+func TestFitLine(t *testing.T) {
+	tests := []struct {
+		text  string
+		width int
+		line  string
+	}{
+		{"PASS", 10, "PASS"},
+		{"0123456789", 4, "0123"},
+		{"── log ──", 4, "── l"},
+		{"\x1b[1mbold\x1b[0m", 10, "bold"},
+		{"\x1b[31mred text", 3, "red"},
+	}
+	for _, test := range tests {
+		if line := fitLine(test.text, test.width); line != test.line {
+			t.Errorf("fitLine(%q, %v) = %q, want %q", test.text, test.width, line, test.line)
+		}
+	}
+}
+
+func TestStripANSI(t *testing.T) {
+	tests := []struct {
+		text     string
+		stripped string
+	}{
+		{"plain", "plain"},
+		{"\x1b[7mstatus\x1b[0m", "status"},
+		{"\x1b[12;1Hrow\x1b[K", "row"},
+		{"\x1b[?25lhidden", "hidden"},
+		{"esc\x1b", "esc"},
+		{"unterminated\x1b[12", "unterminated"},
+	}
+	for _, test := range tests {
+		if stripped := stripANSI(test.text); stripped != test.stripped {
+			t.Errorf("stripANSI(%q) = %q, want %q", test.text, stripped, test.stripped)
+		}
+	}
+}
+
+func TestPadLine(t *testing.T) {
+	tests := []struct {
+		text  string
+		width int
+		line  string
+	}{
+		{"ab", 4, "ab  "},
+		{"abcd", 4, "abcd"},
+		{"abcdef", 4, "abcdef"},
+	}
+	for _, test := range tests {
+		if line := padLine(test.text, test.width); line != test.line {
+			t.Errorf("padLine(%q, %v) = %q, want %q", test.text, test.width, line, test.line)
+		}
+	}
+}
+
+func TestPaneTitle(t *testing.T) {
+	tests := []struct {
+		title string
+		width int
+		line  string
+	}{
+		{"EPrommer", 16, "── EPrommer ────"},
+		{"log", 5, "── log "},
+	}
+	for _, test := range tests {
+		if line := paneTitle(test.title, test.width); line != test.line {
+			t.Errorf("paneTitle(%q, %v) = %q, want %q", test.title, test.width, line, test.line)
+		}
+	}
+}
@@ -1,14 +1,17 @@
 package main
 
 import (
-	"os"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // AndoSerialConnection TTY connection to Programmer
 type AndoSerialConnection struct {
-	tty      *os.File
-	device   string
+	tty      io.ReadWriteCloser // local TTY or network connection
+	device   string             // TTY device, tcp://host:port or rfc2217://host:port
 	baudrate int
 	timeout  time.Duration
 }
@@ -17,12 +20,34 @@ type AndoSerialConnection struct {
 type ConnState int
 
 const (
-	NormalInput  ConnState = 0
-	CommandInput           = 1
-	ReceiveData            = 2
-	SendData               = 3
+	NormalInput   ConnState = 0
+	CommandInput            = 1
+	ReceiveData             = 2
+	SendData                = 3
+	DeviceCommand           = 4 // device command was sent, waiting for '[PASS]'
+	VerifyData              = 5 // data sent for device VERIFY (U8), waiting for result
+	Editing                 = 6 // hex editor is shown
 )
 
+// String returns state of connection as shown in status displays
+func (state ConnState) String() string {
+	switch state {
+	case NormalInput, CommandInput:
+		return "idle"
+	case ReceiveData:
+		return "downloading"
+	case SendData:
+		return "uploading"
+	case DeviceCommand:
+		return "device command"
+	case VerifyData:
+		return "verifying"
+	case Editing:
+		return "editing"
+	}
+	return "unknown"
+}
+
 type TransferFormat int
 
 const (
@@ -31,23 +56,115 @@ const (
 	F_GENERIC                   = 2
 )
 
+// String returns name of transfer format
+func (format TransferFormat) String() string {
+	switch format {
+	case F_ASCIIHex:
+		return "ASCII-Hex"
+	case F_HP64000ABS:
+		return "HP64000ABS"
+	case F_GENERIC:
+		return "Generic"
+	}
+	return "unknown"
+}
+
+// parseTransferFormat returns transfer format for name, e.g. "hp64k" or "ASCII-Hex"
+func parseTransferFormat(name string) (TransferFormat, bool) {
+	switch strings.ToLower(name) {
+	case "ascii-hex", "asciihex", "hex":
+		return F_ASCIIHex, true
+	case "hp64000abs", "hp64k", "abs":
+		return F_HP64000ABS, true
+	case "generic":
+		return F_GENERIC, true
+	}
+	return F_ASCIIHex, false
+}
+
+// newContinueLoop returns flag for a running command loop
+func newContinueLoop() *atomic.Bool {
+	continueLoop := new(atomic.Bool)
+	continueLoop.Store(true)
+	return continueLoop
+}
+
+// running returns true as long as command loop of session runs
+func running(ando *AndoConnection) bool {
+	return ando.continueLoop != nil && ando.continueLoop.Load()
+}
+
+// stopRunning ends command loop and ttyReader of session
+func stopRunning(ando *AndoConnection) {
+	if ando.continueLoop != nil {
+		ando.continueLoop.Store(false)
+	}
+}
+
 // Connection connection to Eprommer
 type AndoConnection struct {
-	continueLoop   int       // true as long as command loop runs
-	state          ConnState // state of app
-	dryMode        bool      // dry mode means do not really invoke EPrommer device
-	debug          int       // debug level
-	batch          bool      // batch mode
-	uploadFile     string    // file to upload to EPrommer device
-	downloadFile   string    // file to download from EPrommer device
+	continueLoop   *atomic.Bool     // true as long as command loop runs, read by ttyReader
+	state          ConnState        // state of app
+	dryMode        bool             // dry mode means do not really invoke EPrommer device
+	debug          int              // debug level
+	batch          bool             // batch mode
+	model          string           // EPrommer model, stored with every dump
+	firmware       *FirmwareProfile // EPrommer firmware selected with --firmware
+	note           string           // operator note, stored with every dump
+	uploadFile     string           // file to upload to EPrommer device
+	downloadFile   string           // file to download from EPrommer device
+	referenceFile  string           // reference file to verify downloaded data against
+	maxDiffs       int              // maximum number of differing bytes reported by verify
+	copyFirst      bool             // copy socket EPROM into RAM buffer (DEVICE-COPY) before download
 	transferFormat TransferFormat
 	serial         *AndoSerialConnection // Serial onnection structure used
 	lineInfos      []LineInfo            // internal representation of EPROM data during download
+	edits          map[int]byte          // bytes of lineInfos edited in hex editor, address -> original value
 	checksum       uint32                // checksum value
+	checksums      Checksums             // all checksums of last transfer
+	uploadSums     Checksums             // checksums of image uploaded last
+	sumStart       int                   // start of range checksums are calculated over
+	sumLength      int                   // length of range checksums are calculated over, -1 for all
+	catalog        []CatalogEntry        // known ROM images
+	identified     string                // name of known ROM image downloaded last, "" if unknown
+	console        []byte                // recent human-readable output of EPrommer, guarded by consoleLock
+	consoleLock    *sync.Mutex           // guards console, written by ttyReader and read by other goroutines
+	consoleHook    func(chunk []byte)    // called with human-readable output of EPrommer, e.g. by HTTP API
+	romType        *RomType              // ROM type selected on EPrommer, nil if unknown
+	romCode        string                // ROM type code sent by EPrommer, "" if unknown
+	romQueried     bool                  // ROM type was queried from EPrommer in this session
+	force          bool                  // upload even if image does not fit into ROM type
+	selectRomType  string                // ROM type to select on start, "" to keep selection of EPrommer
+	lanes          int                   // number of byte lanes (chips) of a 16-bit or 32-bit image, 1 for 8-bit
+	lane           int                   // byte lane (chip) to up- or download
+	rangeStart     int                   // start of range used from file (upload) or RAM buffer (download)
+	rangeLength    int                   // length of range used, -1 up to end
+	offset         int                   // address in RAM buffer (upload) or file (download) range is placed at
+	fill           byte                  // fill byte for padding, rounding and trimming (0xff for EPROMs)
+	pad            bool                  // pad upload image to size of ROM type
+	trim           bool                  // trim trailing fill bytes
+	round          bool                  // round upload image to record boundary
 	recordPosition int                   // position in record
+	transferErrors int                   // number of errors in last download
+	lastPassed     bool                  // true if EPrommer answered last command/transfer with '[PASS]'
+	lastReply      string                // last result message sent by EPrommer (without brackets)
 	hp64k          *HP64KInfo            // structure required for F_HP64000ABS transfer format
+	progress       *Progress             // progress of transfer running or done last
+	lineMode       bool                  // keyboard input is edited as a line and sent on Enter
+	history        *History              // lines entered in line mode
 	startTime      time.Time
 	stopTime       time.Time
+
+	// protocol state, kept per session so that several EPrommers can be driven in parallel
+	generic                *GenericData  // raw data received during download
+	endCriteriaTest        int           // number of chars of '[PASS]' matched so far
+	failMessage            []byte        // result message collected so far
+	failCriteriaCollecting bool          // true while a result message is collected
+	name                   string        // device name, shown in gang mode
+	quiet                  bool          // output of EPrommer is not printed (gang mode)
+	board                  *StatusBoard  // status published for other goroutines (gang mode), nil if not published
+	sessionLock            *sync.Mutex   // held by keyboard commands and HTTP API jobs using the session
+	transferHold           chan struct{} // holds session of a keyboard command until its transfer ended
 }
 
 // LineInfo info for a line sent by Programmer Device
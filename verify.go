@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+// ByteDiff a byte differing between reference image and data read from EPrommer
+type ByteDiff struct {
+	address  uint32
+	expected byte
+	actual   byte
+}
+
+// VerifyResult result of comparing data read from EPrommer with a reference image
+type VerifyResult struct {
+	expectedSize int        // size of reference image
+	actualSize   int        // size of data read from EPrommer
+	mismatches   int        // number of differing bytes (including bytes missing in data read)
+	diffs        []ByteDiff // first differing bytes
+}
+
+// passed returns true if all bytes of reference image were found in data read
+func (result *VerifyResult) passed() bool {
+	return result.mismatches == 0
+}
+
+// compareImages compares data read from EPrommer byte by byte with reference image.
+// Only the first maxDiffs differences are recorded in detail.
+func compareImages(expected []byte, actual []byte, maxDiffs int) VerifyResult {
+	result := VerifyResult{
+		expectedSize: len(expected),
+		actualSize:   len(actual),
+	}
+	for i, e := range expected {
+		if i >= len(actual) {
+			// data read is too short, all remaining bytes are missing
+			result.mismatches += len(expected) - i
+			break
+		}
+		if e != actual[i] {
+			result.mismatches++
+			if len(result.diffs) < maxDiffs {
+				result.diffs = append(result.diffs, ByteDiff{uint32(i), e, actual[i]})
+			}
+		}
+	}
+	return result
+}
+
+// printVerifyResult pretty print result of a verify
+func printVerifyResult(result VerifyResult) {
+	if result.actualSize != result.expectedSize {
+		log.Printf("Size differs: reference has %v bytes, EPrommer data has %v bytes\n\r", result.expectedSize, result.actualSize)
+	}
+	if len(result.diffs) > 0 {
+		fmt.Printf("Address  Expected Actual\n\r")
+		for _, diff := range result.diffs {
+			fmt.Printf("%08x %02x       %02x\n\r", diff.address, diff.expected, diff.actual)
+		}
+		if result.mismatches > len(result.diffs) {
+			fmt.Printf("... %v more\n\r", result.mismatches-len(result.diffs))
+		}
+	}
+	if result.passed() {
+		log.Printf("Verify PASSED, %v bytes are identical\n\r", result.expectedSize)
+	} else {
+		log.Printf("Verify FAILED, %v mismatches\n\r", result.mismatches)
+	}
+}
+
+// verifyDownload compares data downloaded last with reference file. Returns true if verify passed.
+func verifyDownload(ando *AndoConnection) bool {
+	reference, err := loadImage(ando.referenceFile)
+	if err != nil {
+		logf(ando, "Error loading reference file %s: %s\n\r", ando.referenceFile, err)
+		return false
+	}
+	logf(ando, "Verifying %v bytes against reference file %s\n\r", len(reference), ando.referenceFile)
+	result := compareImages(reference, downloadedImage(ando), ando.maxDiffs)
+	printVerifyResult(result)
+	return result.passed()
+}
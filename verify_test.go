@@ -0,0 +1,39 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompareImages(t *testing.T) {
+	tests := []struct {
+		name       string
+		expected   []byte
+		actual     []byte
+		maxDiffs   int
+		mismatches int
+		diffs      []ByteDiff
+	}{
+		{"identical", []byte{1, 2, 3}, []byte{1, 2, 3}, 10, 0, nil},
+		{"empty", nil, nil, 10, 0, nil},
+		{"one differing byte", []byte{1, 2, 3}, []byte{1, 0, 3}, 10, 1, []ByteDiff{{1, 2, 0}}},
+		{"diffs limited", []byte{1, 2, 3}, []byte{0, 0, 0}, 2, 3, []ByteDiff{{0, 1, 0}, {1, 2, 0}}},
+		{"data read too short", []byte{1, 2, 3, 4}, []byte{1, 2}, 10, 2, nil},
+		{"data read longer", []byte{1, 2}, []byte{1, 2, 3, 4}, 10, 0, nil},
+	}
+	for _, test := range tests {
+		result := compareImages(test.expected, test.actual, test.maxDiffs)
+		if result.mismatches != test.mismatches {
+			t.Errorf("%v: %v mismatches, want %v", test.name, result.mismatches, test.mismatches)
+		}
+		if !reflect.DeepEqual(result.diffs, test.diffs) {
+			t.Errorf("%v: diffs %v, want %v", test.name, result.diffs, test.diffs)
+		}
+		if result.passed() != (test.mismatches == 0) {
+			t.Errorf("%v: passed() is %v", test.name, result.passed())
+		}
+		if result.expectedSize != len(test.expected) || result.actualSize != len(test.actual) {
+			t.Errorf("%v: sizes %v/%v", test.name, result.expectedSize, result.actualSize)
+		}
+	}
+}
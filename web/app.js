@@ -0,0 +1,191 @@
+// Web UI of AndoPromacUI, uses HTTP API only (see api.go)
+
+const $ = (id) => document.getElementById(id);
+let buffer = null; // data downloaded last
+const HEX_LINES = 256;
+
+async function api(method, path, body) {
+  const response = await fetch(path, {method: method, body: body});
+  const type = response.headers.get("Content-Type") || "";
+  const result = type.startsWith("application/json") ? await response.json() : await response.arrayBuffer();
+  if (!response.ok) {
+    throw new Error(result.error || response.statusText);
+  }
+  return result;
+}
+
+function report(error) {
+  terminal("\n[" + error.message + "]\n");
+}
+
+function terminal(text) {
+  const pane = $("terminal");
+  pane.textContent = (pane.textContent + text.replace(/\r/g, "")).slice(-100000);
+  pane.scrollTop = pane.scrollHeight;
+}
+
+async function updateStatus() {
+  const status = await api("GET", "/api/status");
+  let text = status.device + " | " + status.state + " | ROM type " + status.romType + " | " + status.format +
+    " | firmware " + status.firmware;
+  if (status.downloaded > 0) {
+    text += " | " + status.downloaded + " bytes downloaded";
+    if (status.checksums) {
+      text += ", crc32 " + status.checksums.crc32;
+    }
+    if (status.identified) {
+      text += " (" + status.identified + ")";
+    }
+  }
+  $("status").textContent = text;
+}
+
+async function updateHistory() {
+  const jobs = await api("GET", "/api/jobs") || [];
+  const rows = jobs.slice().reverse().map((job) => {
+    const started = new Date(job.started);
+    const duration = job.finished ? ((new Date(job.finished) - started) / 1000).toFixed(1) + "s" : "";
+    return "<tr><td>" + job.id + "</td><td>" + escape(job.name) + "</td><td class=\"" + job.state + "\">" +
+      job.state + "</td><td>" + escape(job.reply || "") + "</td><td>" + started.toLocaleTimeString() +
+      "</td><td>" + duration + "</td></tr>";
+  });
+  $("history").innerHTML = rows.join("");
+}
+
+function escape(text) {
+  return text.replace(/[&<>"]/g, (c) => ({"&": "&amp;", "<": "&lt;", ">": "&gt;", "\"": "&quot;"}[c]));
+}
+
+async function updateHex() {
+  try {
+    buffer = new Uint8Array(await api("GET", "/api/buffer?format=bin"));
+  } catch (error) {
+    buffer = null;
+    $("hex").textContent = error.message;
+    $("hex-info").textContent = "";
+    return;
+  }
+  $("hex-info").textContent = "(" + buffer.length + " bytes)";
+  renderHex();
+}
+
+function renderHex() {
+  if (!buffer) {
+    return;
+  }
+  const start = (parseInt($("hex-goto").value || "0") || 0) & ~0xf;
+  const lines = [];
+  for (let address = start; address < buffer.length && lines.length < HEX_LINES; address += 16) {
+    const bytes = Array.from(buffer.slice(address, address + 16));
+    const hex = bytes.map((b) => b.toString(16).padStart(2, "0")).join(" ");
+    const ascii = bytes.map((b) => (b >= 0x20 && b < 0x7f ? String.fromCharCode(b) : ".")).join("");
+    lines.push(address.toString(16).padStart(8, "0") + "  " + hex.padEnd(48) + " |" + ascii + "|");
+  }
+  if (start + HEX_LINES * 16 < buffer.length) {
+    lines.push("... (goto an address to see more)");
+  }
+  $("hex").textContent = lines.join("\n");
+}
+
+async function upload(file) {
+  const data = await file.arrayBuffer();
+  await api("POST", "/api/upload?name=" + encodeURIComponent(file.name), data);
+  terminal("\n[Uploading " + file.name + ", " + data.byteLength + " bytes]\n");
+}
+
+function saveBuffer() {
+  if (!buffer) {
+    report(new Error("no data downloaded yet"));
+    return;
+  }
+  const link = document.createElement("a");
+  link.href = "/api/buffer?format=bin";
+  link.download = "";
+  link.click();
+}
+
+// keys typed like in the help text: <CR> and <SPACE> are replaced
+function parseKeys(text) {
+  return text.replace(/<CR>/gi, "\r").replace(/<SPACE>/gi, " ");
+}
+
+function connectEvents() {
+  const events = new EventSource("/api/events");
+  events.addEventListener("console", (event) => terminal(JSON.parse(event.data)));
+  events.addEventListener("job", (event) => {
+    const job = JSON.parse(event.data);
+    $("progress").textContent = "Job " + job.id + " " + job.name + ": " + job.state;
+    updateHistory().catch(report);
+    updateStatus().catch(report);
+    if (job.state !== "running" && job.name === "download") {
+      updateHex();
+    }
+  });
+  events.addEventListener("progress", (event) => {
+    const progress = JSON.parse(event.data);
+    let text = "Job " + progress.job + ": " + progress.state + ", " + progress.seconds.toFixed(0) + "s";
+    if (progress.operation) {
+      text += ", " + progress.operation + " " + progress.done + (progress.total ? "/" + progress.total : "") +
+        " bytes, " + progress.rate.toFixed(0) + " bytes/s";
+      if (progress.eta !== undefined) {
+        text += ", ETA " + progress.eta.toFixed(0) + "s";
+      }
+    }
+    $("progress").textContent = text;
+  });
+}
+
+function setup() {
+  document.querySelectorAll("[data-job]").forEach((button) => {
+    button.addEventListener("click", () => api("POST", "/api/" + button.dataset.job).catch(report));
+  });
+  document.querySelectorAll("[data-keys]").forEach((button) => {
+    button.addEventListener("click", () => api("POST", "/api/keys", button.dataset.keys).catch(report));
+  });
+  const actions = {
+    romtype: () => api("POST", "/api/romtype?name=" + encodeURIComponent($("romtype").value)).then(updateStatus),
+    format: () => api("POST", "/api/format?name=" + $("format").value).then(updateStatus),
+    write: () => api("POST", "/api/write").then((result) => terminal("\n[Wrote " + result.file + "]\n")),
+    save: async () => saveBuffer(),
+    hex: updateHex,
+  };
+  document.querySelectorAll("[data-action]").forEach((button) => {
+    button.addEventListener("click", () => actions[button.dataset.action]().catch(report));
+  });
+  $("keys").addEventListener("submit", (event) => {
+    event.preventDefault();
+    api("POST", "/api/keys", parseKeys($("keys-input").value)).catch(report);
+    $("keys-input").value = "";
+  });
+  $("hex-goto").addEventListener("change", renderHex);
+
+  const drop = $("drop");
+  drop.addEventListener("click", () => $("file").click());
+  $("file").addEventListener("change", () => {
+    if ($("file").files.length > 0) {
+      upload($("file").files[0]).catch(report);
+    }
+  });
+  drop.addEventListener("dragover", (event) => {
+    event.preventDefault();
+    drop.classList.add("over");
+  });
+  drop.addEventListener("dragleave", () => drop.classList.remove("over"));
+  drop.addEventListener("drop", (event) => {
+    event.preventDefault();
+    drop.classList.remove("over");
+    if (event.dataTransfer.files.length > 0) {
+      upload(event.dataTransfer.files[0]).catch(report);
+    }
+  });
+
+  api("GET", "/api/romtypes").then((names) => {
+    $("romtype").innerHTML = names.map((name) => "<option>" + name + "</option>").join("");
+  }).catch(report);
+  connectEvents();
+  updateStatus().catch(report);
+  updateHistory().catch(report);
+  updateHex();
+}
+
+setup();
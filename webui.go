@@ -0,0 +1,19 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// Web UI for people not comfortable with the raw-mode terminal, served next to the HTTP API.
+// It is a single page (web/index.html) using the API only.
+
+//go:embed web
+var webFiles embed.FS
+
+// webHandler returns HTTP handler serving embedded web UI
+func webHandler() http.Handler {
+	files, _ := fs.Sub(webFiles, "web")
+	return http.FileServer(http.FS(files))
+}
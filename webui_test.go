@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWebHandler(t *testing.T) {
+	server := httptest.NewServer(webHandler())
+	defer server.Close()
+	tests := []struct {
+		path        string
+		status      int
+		contentType string
+	}{
+		{"/", http.StatusOK, "text/html"},
+		{"/app.js", http.StatusOK, "javascript"},
+		{"/style.css", http.StatusOK, "text/css"},
+		{"/missing.js", http.StatusNotFound, ""},
+	}
+	for _, test := range tests {
+		resp, err := http.Get(server.URL + test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != test.status || !strings.Contains(resp.Header.Get("Content-Type"), test.contentType) {
+			t.Errorf("GET %v = %v %v, want %v %v", test.path, resp.StatusCode, resp.Header.Get("Content-Type"),
+				test.status, test.contentType)
+		}
+	}
+}